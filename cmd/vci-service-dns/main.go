@@ -103,6 +103,7 @@ func main() {
 			&vrfSubscriber{client: comp.Client()},
 			vrfChecker{},
 		),
+		dns.Notifications(comp.Client()),
 		dns.WhenDone(func() { close(done) }),
 	)
 	state := dns.StateNew(config)
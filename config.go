@@ -4,10 +4,12 @@ package dns
 
 import (
 	"io/ioutil"
+	"sort"
 	"sync"
 	"sync/atomic"
 
 	"github.com/danos/encoding/rfc7951"
+	"github.com/danos/mgmterror"
 	"github.com/danos/vyatta-service-dns/internal/dynamic"
 	"github.com/danos/vyatta-service-dns/internal/forwarding"
 	"github.com/danos/vyatta-service-dns/internal/log"
@@ -19,21 +21,24 @@ type ConfigData struct {
 		DNS struct {
 			Forwarding *forwarding.ConfigData `rfc7951:"forwarding,omitempty"`
 			Dynamic    *dynamic.ConfigData    `rfc7951:"dynamic,omitempty"`
+			Metrics    *MetricsConfigData     `rfc7951:"metrics,omitempty"`
 		} `rfc7951:"vyatta-service-dns-v1:dns,omitempty"`
 	} `rfc7951:"vyatta-services-v1:service,omitempty"`
 	Routing struct {
-		RoutingInstance []struct {
-			Name    string `rfc7951:"instance-name"`
-			Service struct {
-				DNS struct {
-					Forwarding *forwarding.ConfigData `rfc7951:"forwarding,omitempty"`
-					Dynamic    *dynamic.ConfigData    `rfc7951:"dynamic,omitempty"`
-				} `rfc7951:"vyatta-service-dns-routing-instance-v1:dns,omitempty"`
-			} `rfc7951:"service,omitempty"`
-		} `rfc7951:"routing-instance,omitempty"`
+		RoutingInstance []RoutingInstanceConfigData `rfc7951:"routing-instance,omitempty"`
 	} `rfc7951:"vyatta-routing-v1:routing,omitempty"`
 }
 
+type RoutingInstanceConfigData struct {
+	Name    string `rfc7951:"instance-name"`
+	Service struct {
+		DNS struct {
+			Forwarding *forwarding.ConfigData `rfc7951:"forwarding,omitempty"`
+			Dynamic    *dynamic.ConfigData    `rfc7951:"dynamic,omitempty"`
+		} `rfc7951:"vyatta-service-dns-routing-instance-v1:dns,omitempty"`
+	} `rfc7951:"service,omitempty"`
+}
+
 type ConfigOpt func(*Config)
 
 func Cache(filename string) ConfigOpt {
@@ -49,12 +54,25 @@ func VRFHelpers(sub process.VRFSubscriber, chk process.VRFChecker) ConfigOpt {
 	}
 }
 
+func Notifications(emitter Emitter) ConfigOpt {
+	return func(c *Config) {
+		c.emitter = emitter
+	}
+}
+
 func WhenDone(done func()) ConfigOpt {
 	return func(c *Config) {
 		c.whenDone = done
 	}
 }
 
+func forwardingOptions(opts func(instance string) []forwarding.ConfigOption) ConfigOpt {
+	//This option is needed for testing but not externally for now
+	return func(c *Config) {
+		c.forwardingOpts = opts
+	}
+}
+
 type Config struct {
 	writeMu       sync.Mutex
 	currentConfig atomic.Value
@@ -62,11 +80,16 @@ type Config struct {
 	dynamicInstances    atomic.Value
 	forwardingInstances atomic.Value
 
+	// metrics is only touched with writeMu held.
+	metrics *metricsServer
+
 	//options
-	cacheFile  string
-	subscriber process.VRFSubscriber
-	vrfChk     process.VRFChecker
-	whenDone   func()
+	cacheFile      string
+	subscriber     process.VRFSubscriber
+	vrfChk         process.VRFChecker
+	emitter        Emitter
+	whenDone       func()
+	forwardingOpts func(instance string) []forwarding.ConfigOption
 }
 
 func ConfigNew(opts ...ConfigOpt) *Config {
@@ -88,9 +111,21 @@ func (c *Config) Get() *ConfigData {
 func (c *Config) Set(newConfig *ConfigData) error {
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
+	oldConfig := c.Get()
+	errs := c.apply(newConfig)
+	if len(errs) != 0 {
+		// Put every instance back the way it was so that the
+		// cache, the files on disk and the daemons agree again.
+		// An instance that fails restores the files it was last
+		// configured with itself.
+		for _, err := range c.apply(oldConfig) {
+			log.Elog.Println("config-set rollback:", err)
+		}
+		var errList mgmterror.MgmtErrorList
+		errList.MgmtErrorListAppend(errs...)
+		return errList
+	}
 	c.writeCache(newConfig)
-	c.syncForwardingInstances(newConfig)
-	c.syncDynamicInstances(newConfig)
 	if newConfig == nil {
 		if c.whenDone != nil {
 			c.whenDone()
@@ -99,48 +134,128 @@ func (c *Config) Set(newConfig *ConfigData) error {
 	return nil
 }
 
+func (c *Config) apply(config *ConfigData) []error {
+	errs := c.syncForwardingInstances(config)
+	errs = append(errs, c.syncDynamicInstances(config)...)
+	c.syncMetrics(config)
+	return errs
+}
+
 func (c *Config) Check(proposedConfig *ConfigData) error {
-	// TODO:We could generate all dnsmasq configs and use dnsmasq -C here
+	newFIs := forwardingConfigs(proposedConfig)
+	names := make([]string, 0, len(newFIs))
+	for name := range newFIs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	forwardingInstances := c.getForwardingInstances()
+	for _, name := range names {
+		fconf := newFIs[name]
+		if fconf == nil {
+			continue
+		}
+		inst, ok := forwardingInstances[name]
+		if !ok {
+			inst = forwarding.NewInstanceConfig(name,
+				c.forwardingInstanceOptions(name)...)
+		}
+		err := inst.Check(fconf)
+		if cerr, ok := err.(*forwarding.ConfigError); ok {
+			merr := mgmterror.NewInvalidValueApplicationError()
+			merr.Path = forwardingPath(name) + "/" + cerr.Path
+			merr.Message = cerr.Message
+			return merr
+		}
+		if err != nil {
+			merr := mgmterror.NewInvalidValueApplicationError()
+			merr.Path = forwardingPath(name)
+			merr.Message = "Invalid DNS forwarding configuration: " +
+				err.Error()
+			return merr
+		}
+	}
 	return nil
 }
 
-func (c *Config) syncForwardingInstances(newConfig *ConfigData) {
-	newFIs := make(map[string]*forwarding.ConfigData)
-	if newConfig != nil {
-		if newConfig.Service.DNS.Forwarding != nil {
-			newFIs["default"] = newConfig.Service.DNS.Forwarding
-		}
-		for _, ri := range newConfig.Routing.RoutingInstance {
-			newFIs[ri.Name] = ri.Service.DNS.Forwarding
+func forwardingPath(instance string) string {
+	if instance == "default" {
+		return "/service/dns/forwarding"
+	}
+	return "/routing/routing-instance/" + instance +
+		"/service/dns/forwarding"
+}
+
+func forwardingConfigs(config *ConfigData) map[string]*forwarding.ConfigData {
+	out := make(map[string]*forwarding.ConfigData)
+	if config == nil {
+		return out
+	}
+	if config.Service.DNS.Forwarding != nil {
+		out["default"] = config.Service.DNS.Forwarding
+	}
+	for _, ri := range config.Routing.RoutingInstance {
+		out[ri.Name] = ri.Service.DNS.Forwarding
+	}
+	return out
+}
+
+func (c *Config) forwardingInstanceOptions(instance string) []forwarding.ConfigOption {
+	var opts []forwarding.ConfigOption
+	if instance == "default" {
+		opts = []forwarding.ConfigOption{
+			forwarding.ResolvFile("/etc/resolv.conf"),
+			forwarding.HostsFile("/etc/hosts"),
 		}
 	}
+	if c.forwardingOpts != nil {
+		opts = append(opts, c.forwardingOpts(instance)...)
+	}
+	return opts
+}
+
+func instanceError(path string, err error) error {
+	merr := mgmterror.NewOperationFailedApplicationError()
+	merr.Path = path
+	merr.Message = err.Error()
+	return merr
+}
+
+func (c *Config) syncForwardingInstances(newConfig *ConfigData) []error {
+	var errs []error
+	newFIs := forwardingConfigs(newConfig)
 	forwardingInstances := c.getForwardingInstances()
 	for k, v := range forwardingInstances {
 		if _, ok := newFIs[k]; ok {
 			continue
 		}
-		v.Set(nil)
+		err := v.Set(nil)
+		if err != nil {
+			errs = append(errs, instanceError(forwardingPath(k), err))
+		}
 	}
 	newFIObjs := make(map[string]*forwarding.Config)
 	for k, v := range newFIs {
 		conf, ok := forwardingInstances[k]
 		if !ok {
-			if k == "default" {
-				conf = forwarding.NewInstanceConfig(k,
-					forwarding.ResolvFile("/etc/resolv.conf"),
-					forwarding.HostsFile("/etc/hosts"))
-			} else {
-				conf = forwarding.NewInstanceConfig(
-					k,
+			var opts []forwarding.ConfigOption
+			if k != "default" {
+				opts = append(opts,
 					forwarding.VRFHelpers(c.subscriber,
-						c.vrfChk),
-				)
+						c.vrfChk))
 			}
+			opts = append(opts, c.forwardingNotifications())
+			opts = append(opts, c.forwardingInstanceOptions(k)...)
+			conf = forwarding.NewInstanceConfig(k, opts...)
+		}
+		err := conf.Set(v)
+		if err != nil {
+			errs = append(errs, instanceError(forwardingPath(k), err))
 		}
-		conf.Set(v)
 		newFIObjs[k] = conf
 	}
 	c.updateForwardingInstances(newFIObjs)
+	return errs
 }
 
 func (c *Config) getForwardingInstances() map[string]*forwarding.Config {
@@ -151,7 +266,16 @@ func (c *Config) updateForwardingInstances(fis map[string]*forwarding.Config) {
 	c.forwardingInstances.Store(fis)
 }
 
-func (c *Config) syncDynamicInstances(newConfig *ConfigData) {
+func dynamicPath(instance string) string {
+	if instance == "default" {
+		return "/service/dns/dynamic"
+	}
+	return "/routing/routing-instance/" + instance +
+		"/service/dns/dynamic"
+}
+
+func (c *Config) syncDynamicInstances(newConfig *ConfigData) []error {
+	var errs []error
 	newDIs := make(map[string]*dynamic.ConfigData)
 	if newConfig != nil {
 		if newConfig.Service.DNS.Dynamic != nil {
@@ -166,7 +290,10 @@ func (c *Config) syncDynamicInstances(newConfig *ConfigData) {
 		if _, ok := newDIs[k]; ok {
 			continue
 		}
-		v.Set(nil)
+		err := v.Set(nil)
+		if err != nil {
+			errs = append(errs, instanceError(dynamicPath(k), err))
+		}
 	}
 	newDIObjs := make(map[string]*dynamic.Config)
 	for k, v := range newDIs {
@@ -182,11 +309,14 @@ func (c *Config) syncDynamicInstances(newConfig *ConfigData) {
 				)
 			}
 		}
-		conf.Set(v)
+		err := conf.Set(v)
+		if err != nil {
+			errs = append(errs, instanceError(dynamicPath(k), err))
+		}
 		newDIObjs[k] = conf
 	}
 	c.updateDynamicInstances(newDIObjs)
-
+	return errs
 }
 
 func (c *Config) getDynamicInstances() map[string]*dynamic.Config {
@@ -0,0 +1,146 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package dns
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danos/mgmterror"
+	"github.com/danos/vyatta-service-dns/internal/forwarding"
+)
+
+// novrf reports no routing instance, dnsmasq is never run for the
+// instances of the tests.
+type novrf struct{}
+
+type novrfSub struct{}
+
+func (novrf) VRFExists(string) bool { return false }
+func (novrfSub) Cancel() error      { return nil }
+
+func (novrf) SubscribeVRFAdd(func(string)) interface{ Cancel() error } {
+	return novrfSub{}
+}
+
+func (novrf) SubscribeVRFDel(func(string)) interface{ Cancel() error } {
+	return novrfSub{}
+}
+
+func testForwardingOptions(instance string) []forwarding.ConfigOption {
+	dir := "tmp/" + instance
+	opts := []forwarding.ConfigOption{
+		forwarding.ENVFile(dir + "/dnsmasq.env"),
+		forwarding.ConfigFile(dir + "/dnsmasq.conf"),
+		forwarding.ConfigDir(dir+"/dnsmasq.d", "*.conf"),
+		forwarding.DHCPConfigFileFmt(dir + "/dnsmasq.d/dhcpinterface-%s.conf"),
+		forwarding.DHCPv6ConfigFileFmt(dir + "/dnsmasq.d/dhcpv6interface-%s.conf"),
+		forwarding.SLAACConfigFileFmt(dir + "/dnsmasq.d/slaacinterface-%s.conf"),
+		forwarding.SystemConfigFile(dir + "/dnsmasq.d/system.conf"),
+		forwarding.PIDFile(dir + "/dnsmasq.pid"),
+		forwarding.StateFile(dir + "/dnsmasq.log"),
+		forwarding.ResolvFile(dir + "/resolv.conf"),
+		forwarding.HostsFile(dir + "/hosts"),
+		forwarding.StaticHostsFile(dir + "/hosts.d/static-hosts"),
+		forwarding.TLSProxyConfigFile(dir + "/stubby.yml"),
+		forwarding.ACLFile(dir + "/acl.nft"),
+		forwarding.ServersFile(dir + "/servers.conf"),
+		forwarding.CacheSnapshotFile(dir + "/cache-snapshot"),
+		forwarding.QueryLogFile(dir + "/queries.json"),
+	}
+	if instance == "default" {
+		opts = append(opts, forwarding.VRFHelpers(novrf{}, novrf{}))
+	}
+	return opts
+}
+
+func testConfigData(cacheSize uint32) *ConfigData {
+	config := &ConfigData{}
+	config.Service.DNS.Forwarding = &forwarding.ConfigData{
+		CacheSize:        cacheSize,
+		ListenInterfaces: []string{"eth0"},
+	}
+	ri := RoutingInstanceConfigData{Name: "blue"}
+	ri.Service.DNS.Forwarding = &forwarding.ConfigData{
+		CacheSize:        cacheSize,
+		ListenInterfaces: []string{"eth1"},
+	}
+	config.Routing.RoutingInstance = []RoutingInstanceConfigData{ri}
+	return config
+}
+
+func TestConfigSetRollback(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("tmp")
+
+	conf := ConfigNew(
+		Cache("tmp/cache"),
+		VRFHelpers(novrf{}, novrf{}),
+		forwardingOptions(testForwardingOptions),
+	)
+	old := testConfigData(150)
+	err = conf.Set(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCache, err := ioutil.ReadFile("tmp/cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The static hosts of blue can't be written.
+	err = ioutil.WriteFile("tmp/blue/hosts.d", nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposed := testConfigData(300)
+	ri := &proposed.Routing.RoutingInstance[0]
+	ri.Service.DNS.Forwarding.StaticHostMappings = []forwarding.StaticHostMapping{
+		{HostName: "host.example.com", Addresses: []string{"192.0.2.1"}},
+	}
+	err = conf.Set(proposed)
+	errList, ok := err.(mgmterror.MgmtErrorList)
+	if !ok {
+		t.Fatalf("expected a MgmtErrorList, got %T %v", err, err)
+	}
+	errs := errList.Errors()
+	if len(errs) != 1 {
+		t.Fatal("expected one error, got", errs)
+	}
+	merr, ok := errs[0].(*mgmterror.OperationFailedApplicationError)
+	if !ok {
+		t.Fatalf("expected an operation failed error, got %T", errs[0])
+	}
+	const path = "/routing/routing-instance/blue/service/dns/forwarding"
+	if merr.Path != path {
+		t.Fatalf("got path %s, expected %s", merr.Path, path)
+	}
+
+	// Every instance is back to the previous configuration.
+	if !reflect.DeepEqual(conf.Get(), old) {
+		t.Fatal("configuration not kept")
+	}
+	cache, err := ioutil.ReadFile("tmp/cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cache) != string(oldCache) {
+		t.Fatal("cache written for the failed configuration")
+	}
+	for _, instance := range []string{"default", "blue"} {
+		buf, err := ioutil.ReadFile("tmp/" + instance + "/dnsmasq.conf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(buf), "cache-size=150") {
+			t.Fatal("configuration of", instance, "not restored:",
+				string(buf))
+		}
+	}
+}
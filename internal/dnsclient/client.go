@@ -0,0 +1,137 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: MPL-2.0
+package dnsclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+const defaultTimeout = 2 * time.Second
+
+type Client struct {
+	// Timeout bounds a whole exchange, defaults to two seconds.
+	Timeout time.Duration
+	// Device binds the client sockets to a network device, this is
+	// used to reach servers inside a routing instance.
+	Device string
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: c.timeout(),
+		Control: func(network, address string, rc syscall.RawConn) error {
+			return BindToDevice(rc, c.Device)
+		},
+	}
+}
+
+// BindToDevice is a net.Dialer/net.ListenConfig control helper that
+// binds the socket to device, an empty device is a no-op.
+func BindToDevice(rc syscall.RawConn, device string) error {
+	if device == "" {
+		return nil
+	}
+	var serr error
+	err := rc.Control(func(fd uintptr) {
+		serr = syscall.BindToDevice(int(fd), device)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// Exchange sends query to server, given as host:port, over UDP and
+// falls back to TCP if the answer is truncated. The round trip time
+// of the final exchange is returned along with the response.
+func (c *Client) Exchange(query *Message, server string) (*Message, time.Duration, error) {
+	req, err := query.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, rtt, err := c.exchange("udp", req, server)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.Truncated {
+		resp, rtt, err = c.exchange("tcp", req, server)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if resp.ID != query.ID {
+		return nil, 0, errors.New("dns response id mismatch")
+	}
+	return resp, rtt, nil
+}
+
+func (c *Client) exchange(network string, req []byte, server string) (*Message, time.Duration, error) {
+	start := time.Now()
+	conn, err := c.dialer().Dial(network, server)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(c.timeout()))
+
+	var buf []byte
+	if network == "tcp" {
+		buf, err = exchangeStream(conn, req)
+	} else {
+		buf, err = exchangeDatagram(conn, req)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	rtt := time.Since(start)
+	resp, err := Unpack(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp, rtt, nil
+}
+
+func exchangeDatagram(conn net.Conn, req []byte) ([]byte, error) {
+	_, err := conn.Write(req)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func exchangeStream(conn net.Conn, req []byte) ([]byte, error) {
+	out := make([]byte, 2, len(req)+2)
+	binary.BigEndian.PutUint16(out, uint16(len(req)))
+	_, err := conn.Write(append(out, req...))
+	if err != nil {
+		return nil, err
+	}
+	var l [2]byte
+	_, err = io.ReadFull(conn, l[:])
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(l[:]))
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
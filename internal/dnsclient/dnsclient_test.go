@@ -0,0 +1,137 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: MPL-2.0
+package dnsclient
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPackUnpackQuery(t *testing.T) {
+	query := NewQuery("servers.bind", TypeTXT, ClassCHAOS)
+	buf, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unpack(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Question{
+		{Name: "servers.bind.", Type: TypeTXT, Class: ClassCHAOS},
+	}
+	if got.ID != query.ID || !got.RecursionDesired {
+		t.Fatal("header not preserved", got)
+	}
+	if !reflect.DeepEqual(got.Question, expected) {
+		t.Log("got", got.Question)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected question")
+	}
+}
+
+func TestUnpackCompressedAnswers(t *testing.T) {
+	msg := []byte{
+		0x12, 0x34, 0x81, 0x80, 0, 1, 0, 3, 0, 0, 0, 0,
+		// www.example.com. IN A
+		3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+		3, 'c', 'o', 'm', 0, 0, 1, 0, 1,
+		// www.example.com. CNAME web.example.com.
+		0xc0, 12, 0, 5, 0, 1, 0, 0, 0, 60, 0, 6,
+		3, 'w', 'e', 'b', 0xc0, 16,
+		// web.example.com. A 192.0.2.1
+		0xc0, 45, 0, 1, 0, 1, 0, 0, 0, 30, 0, 4,
+		192, 0, 2, 1,
+		// example.com. TXT "a" "bc"
+		0xc0, 16, 0, 16, 0, 1, 0, 0, 0, 10, 0, 5,
+		1, 'a', 2, 'b', 'c',
+	}
+	m, err := Unpack(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Response || !m.RecursionAvailable || m.Rcode != RcodeSuccess {
+		t.Fatal("header not decoded", m)
+	}
+	if len(m.Answer) != 3 {
+		t.Fatal("expected 3 answers, got", len(m.Answer))
+	}
+	expected := []struct {
+		name, data string
+		ttl        uint32
+	}{
+		{"www.example.com.", "web.example.com.", 60},
+		{"web.example.com.", "192.0.2.1", 30},
+		{"example.com.", `"a" "bc"`, 10},
+	}
+	for i, ex := range expected {
+		rr := m.Answer[i]
+		if rr.Name != ex.name || rr.Data != ex.data || rr.TTL != ex.ttl {
+			t.Fatalf("answer %d: got %s %d %s", i, rr.Name, rr.TTL, rr.Data)
+		}
+	}
+	if !reflect.DeepEqual(m.Answer[2].Strings, []string{"a", "bc"}) {
+		t.Fatal("didn't get expected txt strings", m.Answer[2].Strings)
+	}
+}
+
+func TestUnpackPointerLoop(t *testing.T) {
+	msg := []byte{
+		0, 1, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0,
+		0xc0, 12, 0, 1, 0, 1,
+	}
+	_, err := Unpack(msg)
+	if err == nil {
+		t.Fatal("expected error for compression loop")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query, err := Unpack(buf[:n])
+		if err != nil {
+			return
+		}
+		resp := &Message{
+			ID:       query.ID,
+			Response: true,
+			Question: query.Question,
+			Answer: []RR{
+				{
+					Name:    query.Question[0].Name,
+					Type:    TypeTXT,
+					Class:   ClassCHAOS,
+					Strings: []string{"150"},
+				},
+			},
+		}
+		out, err := resp.Pack()
+		if err != nil {
+			return
+		}
+		conn.WriteTo(out, addr)
+	}()
+
+	c := &Client{Timeout: 5 * time.Second}
+	resp, _, err := c.Exchange(NewQuery("cachesize.bind", TypeTXT, ClassCHAOS),
+		conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answer) != 1 ||
+		!reflect.DeepEqual(resp.Answer[0].Strings, []string{"150"}) {
+		t.Fatal("didn't get expected answer", resp.Answer)
+	}
+}
@@ -0,0 +1,408 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: MPL-2.0
+package dnsclient
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	TypeA     uint16 = 1
+	TypeNS    uint16 = 2
+	TypeCNAME uint16 = 5
+	TypeSOA   uint16 = 6
+	TypePTR   uint16 = 12
+	TypeMX    uint16 = 15
+	TypeTXT   uint16 = 16
+	TypeAAAA  uint16 = 28
+	TypeSRV   uint16 = 33
+	TypeANY   uint16 = 255
+)
+
+const (
+	ClassINET  uint16 = 1
+	ClassCHAOS uint16 = 3
+)
+
+const (
+	RcodeSuccess        = 0
+	RcodeFormatError    = 1
+	RcodeServerFailure  = 2
+	RcodeNameError      = 3
+	RcodeNotImplemented = 4
+	RcodeRefused        = 5
+)
+
+const headerLen = 12
+
+var (
+	errShortMessage = errors.New("dns message too short")
+	errBadName      = errors.New("invalid domain name")
+	errBadPointer   = errors.New("invalid name compression pointer")
+)
+
+var typeNames = map[uint16]string{
+	TypeA:     "A",
+	TypeNS:    "NS",
+	TypeCNAME: "CNAME",
+	TypeSOA:   "SOA",
+	TypePTR:   "PTR",
+	TypeMX:    "MX",
+	TypeTXT:   "TXT",
+	TypeAAAA:  "AAAA",
+	TypeSRV:   "SRV",
+	TypeANY:   "ANY",
+}
+
+var rcodeNames = map[int]string{
+	RcodeSuccess:        "NOERROR",
+	RcodeFormatError:    "FORMERR",
+	RcodeServerFailure:  "SERVFAIL",
+	RcodeNameError:      "NXDOMAIN",
+	RcodeNotImplemented: "NOTIMP",
+	RcodeRefused:        "REFUSED",
+}
+
+// TypeString returns the mnemonic of a resource record type.
+func TypeString(t uint16) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// StringType is the inverse of TypeString.
+func StringType(s string) (uint16, bool) {
+	s = strings.ToUpper(s)
+	for t, name := range typeNames {
+		if name == s {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// RcodeString returns the mnemonic of a response code.
+func RcodeString(rcode int) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return "RCODE" + strconv.Itoa(rcode)
+}
+
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	// Rdata is the wire format of the record data. When packing a
+	// TXT record Strings is used if Rdata is empty.
+	Rdata []byte
+	// Data is the presentation format of the record data.
+	Data string
+	// Strings holds the character strings of a TXT record.
+	Strings []string
+}
+
+type Message struct {
+	ID                 uint16
+	Response           bool
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	Rcode              int
+
+	Question []Question
+	Answer   []RR
+}
+
+// NewQuery builds a single question query with a random ID.
+func NewQuery(name string, qtype, qclass uint16) *Message {
+	return &Message{
+		ID:               uint16(rand.Uint32()),
+		RecursionDesired: true,
+		Question: []Question{
+			{Name: name, Type: qtype, Class: qclass},
+		},
+	}
+}
+
+func (m *Message) Pack() ([]byte, error) {
+	buf := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(buf[0:], m.ID)
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	flags |= uint16(m.Rcode & 0xf)
+	binary.BigEndian.PutUint16(buf[2:], flags)
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(m.Question)))
+	binary.BigEndian.PutUint16(buf[6:], uint16(len(m.Answer)))
+
+	var err error
+	for _, q := range m.Question {
+		buf, err = packName(buf, q.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf = appendUint16(buf, q.Type)
+		buf = appendUint16(buf, q.Class)
+	}
+	for _, rr := range m.Answer {
+		buf, err = packName(buf, rr.Name)
+		if err != nil {
+			return nil, err
+		}
+		buf = appendUint16(buf, rr.Type)
+		buf = appendUint16(buf, rr.Class)
+		buf = appendUint16(buf, uint16(rr.TTL>>16))
+		buf = appendUint16(buf, uint16(rr.TTL))
+		rdata := rr.Rdata
+		if len(rdata) == 0 && rr.Type == TypeTXT {
+			for _, s := range rr.Strings {
+				if len(s) > 255 {
+					return nil, errors.New("txt string too long")
+				}
+				rdata = append(rdata, byte(len(s)))
+				rdata = append(rdata, s...)
+			}
+		}
+		buf = appendUint16(buf, uint16(len(rdata)))
+		buf = append(buf, rdata...)
+	}
+	return buf, nil
+}
+
+// Unpack decodes the header, question and answer sections of msg.
+// The authority and additional sections are ignored.
+func Unpack(msg []byte) (*Message, error) {
+	if len(msg) < headerLen {
+		return nil, errShortMessage
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	m := &Message{
+		ID:                 binary.BigEndian.Uint16(msg[0:]),
+		Response:           flags&(1<<15) != 0,
+		Authoritative:      flags&(1<<10) != 0,
+		Truncated:          flags&(1<<9) != 0,
+		RecursionDesired:   flags&(1<<8) != 0,
+		RecursionAvailable: flags&(1<<7) != 0,
+		Rcode:              int(flags & 0xf),
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := headerLen
+	for i := 0; i < qdcount; i++ {
+		name, n, err := unpackName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(msg) {
+			return nil, errShortMessage
+		}
+		m.Question = append(m.Question, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[off:]),
+			Class: binary.BigEndian.Uint16(msg[off+2:]),
+		})
+		off += 4
+	}
+	for i := 0; i < ancount; i++ {
+		rr, n, err := unpackRR(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		m.Answer = append(m.Answer, rr)
+	}
+	return m, nil
+}
+
+func unpackRR(msg []byte, off int) (RR, int, error) {
+	var rr RR
+	name, off, err := unpackName(msg, off)
+	if err != nil {
+		return rr, 0, err
+	}
+	if off+10 > len(msg) {
+		return rr, 0, errShortMessage
+	}
+	rr.Name = name
+	rr.Type = binary.BigEndian.Uint16(msg[off:])
+	rr.Class = binary.BigEndian.Uint16(msg[off+2:])
+	rr.TTL = binary.BigEndian.Uint32(msg[off+4:])
+	rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+	if off+rdlen > len(msg) {
+		return rr, 0, errShortMessage
+	}
+	rr.Rdata = msg[off : off+rdlen]
+	err = rr.decodeData(msg, off)
+	if err != nil {
+		return rr, 0, err
+	}
+	return rr, off + rdlen, nil
+}
+
+func (rr *RR) decodeData(msg []byte, off int) error {
+	rdata := rr.Rdata
+	switch rr.Type {
+	case TypeA, TypeAAAA:
+		if len(rdata) != net.IPv4len && len(rdata) != net.IPv6len {
+			return errors.New("invalid address record")
+		}
+		rr.Data = net.IP(rdata).String()
+	case TypeNS, TypeCNAME, TypePTR:
+		name, _, err := unpackName(msg, off)
+		if err != nil {
+			return err
+		}
+		rr.Data = name
+	case TypeMX:
+		if len(rdata) < 3 {
+			return errShortMessage
+		}
+		name, _, err := unpackName(msg, off+2)
+		if err != nil {
+			return err
+		}
+		rr.Data = fmt.Sprintf("%d %s",
+			binary.BigEndian.Uint16(rdata), name)
+	case TypeSRV:
+		if len(rdata) < 7 {
+			return errShortMessage
+		}
+		name, _, err := unpackName(msg, off+6)
+		if err != nil {
+			return err
+		}
+		rr.Data = fmt.Sprintf("%d %d %d %s",
+			binary.BigEndian.Uint16(rdata),
+			binary.BigEndian.Uint16(rdata[2:]),
+			binary.BigEndian.Uint16(rdata[4:]),
+			name)
+	case TypeTXT:
+		var quoted []string
+		for i := 0; i < len(rdata); {
+			l := int(rdata[i])
+			i++
+			if i+l > len(rdata) {
+				return errShortMessage
+			}
+			s := string(rdata[i : i+l])
+			rr.Strings = append(rr.Strings, s)
+			quoted = append(quoted, strconv.Quote(s))
+			i += l
+		}
+		rr.Data = strings.Join(quoted, " ")
+	case TypeSOA:
+		mname, n, err := unpackName(msg, off)
+		if err != nil {
+			return err
+		}
+		rname, n, err := unpackName(msg, n)
+		if err != nil {
+			return err
+		}
+		if n+20 > len(msg) {
+			return errShortMessage
+		}
+		rr.Data = fmt.Sprintf("%s %s %d %d %d %d %d", mname, rname,
+			binary.BigEndian.Uint32(msg[n:]),
+			binary.BigEndian.Uint32(msg[n+4:]),
+			binary.BigEndian.Uint32(msg[n+8:]),
+			binary.BigEndian.Uint32(msg[n+12:]),
+			binary.BigEndian.Uint32(msg[n+16:]))
+	default:
+		rr.Data = hex.EncodeToString(rdata)
+	}
+	return nil
+}
+
+func packName(buf []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, errBadName
+			}
+			buf = append(buf, byte(len(label)))
+			buf = append(buf, label...)
+		}
+	}
+	return append(buf, 0), nil
+}
+
+// unpackName decodes the possibly compressed name at off and returns
+// it in presentation format along with the offset following it.
+func unpackName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for hops := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errShortMessage
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			off++
+			if end < 0 {
+				end = off
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errShortMessage
+			}
+			hops++
+			if hops > 64 {
+				return "", 0, errBadPointer
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		case l&0xc0 != 0:
+			return "", 0, errBadName
+		default:
+			off++
+			if off+l > len(msg) {
+				return "", 0, errShortMessage
+			}
+			labels = append(labels, string(msg[off:off+l]))
+			off += l
+		}
+	}
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
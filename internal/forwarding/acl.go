@@ -0,0 +1,181 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+// dnsmasq can only restrict queries by interface, clients are
+// filtered by source prefix with an nftables table per instance. The
+// table is replaced atomically by declaring, deleting and recreating
+// it in a single transaction.
+const aclFile = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+table inet {{.Table}}
+delete table inet {{.Table}}
+table inet {{.Table}} {
+	chain prerouting {
+		type filter hook prerouting priority -150; policy accept;
+		iifname { {{range $i, $intf := .Interfaces}}{{if $i}}, {{end}}"{{$intf}}"{{end}} } udp dport 53 fib daddr type local jump acl
+		iifname { {{range $i, $intf := .Interfaces}}{{if $i}}, {{end}}"{{$intf}}"{{end}} } tcp dport 53 fib daddr type local jump acl
+	}
+	chain acl {
+{{- range .ACL.Rules}}
+		{{with .Interface}}iifname "{{.}}" {{end}}{{family .Source}} saddr {{.Source}} {{action .Action}}
+{{- end}}
+{{- if eq .ACL.DefaultAction "drop"}}
+		drop
+{{- end}}
+	}
+}
+`
+
+var aclFileTemplate *template.Template
+
+func init() {
+	t := template.New("ACLRuleset")
+	t.Funcs(template.FuncMap{
+		"family": func(prefix string) string {
+			if strings.Contains(prefix, ":") {
+				return "ip6"
+			}
+			return "ip"
+		},
+		"action": func(action string) string {
+			if action == "drop" {
+				return "drop"
+			}
+			return "accept"
+		},
+	})
+	aclFileTemplate = template.Must(t.Parse(aclFile))
+}
+
+const nftBinary = "/usr/sbin/nft"
+
+type AccessControl struct {
+	DefaultAction string        `rfc7951:"default-action,omitempty"`
+	Rules         []ACLRuleData `rfc7951:"rule,omitempty"`
+}
+
+type ACLRuleData struct {
+	Number    uint32 `rfc7951:"tagnode"`
+	Action    string `rfc7951:"action"`
+	Source    string `rfc7951:"source"`
+	Interface string `rfc7951:"interface,omitempty"`
+}
+
+// enforced reports whether acl filters anything at all.
+func (acl *AccessControl) enforced() bool {
+	return acl != nil && (len(acl.Rules) > 0 || acl.DefaultAction == "drop")
+}
+
+func aclTable(instance string) string {
+	return "vyatta-dns-" + instance
+}
+
+func writeACLRuleset(
+	w io.Writer,
+	instance string,
+	acl *AccessControl,
+	interfaces []string,
+) error {
+	// Rules are evaluated in the order of their numbers.
+	sorted := *acl
+	sorted.Rules = append([]ACLRuleData(nil), acl.Rules...)
+	sort.Slice(sorted.Rules, func(i, j int) bool {
+		return sorted.Rules[i].Number < sorted.Rules[j].Number
+	})
+	tmplInput := struct {
+		Table      string
+		Interfaces []string
+		ACL        *AccessControl
+	}{
+		Table:      aclTable(instance),
+		Interfaces: interfaces,
+		ACL:        &sorted,
+	}
+	return aclFileTemplate.Execute(w, &tmplInput)
+}
+
+func runNft(args ...string) error {
+	out, err := exec.Command(nftBinary, args...).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	msg := strings.TrimSpace(string(out))
+	if msg == "" {
+		return err
+	}
+	return errors.New(msg)
+}
+
+type aclConfig struct {
+	instance string
+	file     string
+	nft      func(args ...string) error
+	current  []byte
+}
+
+func (c *aclConfig) Set(acl *AccessControl, interfaces []string) error {
+	if !acl.enforced() || len(interfaces) == 0 {
+		return c.remove()
+	}
+
+	var buf bytes.Buffer
+	err := writeACLRuleset(&buf, c.instance, acl, interfaces)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(buf.Bytes(), c.current) {
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(c.file), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(c.file, buf.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	c.current = nil
+	err = c.nft("-f", c.file)
+	if err != nil {
+		return err
+	}
+	c.current = buf.Bytes()
+	return nil
+}
+
+func (c *aclConfig) remove() error {
+	if c.current == nil {
+		if _, err := os.Stat(c.file); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	c.current = nil
+	err := c.nft("delete", "table", "inet", aclTable(c.instance))
+	if err != nil {
+		// The table is already gone if the ruleset was never
+		// loaded.
+		log.Dlog.Println("forwarding-acl:", err)
+	}
+	err = os.Remove(c.file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testAccessControl() *AccessControl {
+	return &AccessControl{
+		DefaultAction: "drop",
+		Rules: []ACLRuleData{
+			{Number: 20, Action: "accept", Source: "2001:db8::/32"},
+			{Number: 10, Action: "drop", Source: "192.0.2.128/25",
+				Interface: "eth1"},
+			{Number: 15, Action: "accept", Source: "192.0.2.0/24"},
+		},
+	}
+}
+
+func TestWriteACLRuleset(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeACLRuleset(&buf, "blue", testAccessControl(),
+		[]string{"eth0", "eth1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+table inet vyatta-dns-blue
+delete table inet vyatta-dns-blue
+table inet vyatta-dns-blue {
+	chain prerouting {
+		type filter hook prerouting priority -150; policy accept;
+		iifname { "eth0", "eth1" } udp dport 53 fib daddr type local jump acl
+		iifname { "eth0", "eth1" } tcp dport 53 fib daddr type local jump acl
+	}
+	chain acl {
+		iifname "eth1" ip saddr 192.0.2.128/25 drop
+		ip saddr 192.0.2.0/24 accept
+		ip6 saddr 2001:db8::/32 accept
+		drop
+	}
+}
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestACLConfigSet(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("tmp")
+
+	var calls []string
+	c := &aclConfig{
+		instance: "blue",
+		file:     "tmp/acl.nft",
+		nft: func(args ...string) error {
+			calls = append(calls, strings.Join(args, " "))
+			return nil
+		},
+	}
+	// Nothing to remove when no ruleset was ever loaded.
+	err = c.Set(nil, []string{"eth0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acl := testAccessControl()
+	for i := 0; i < 2; i++ {
+		err = c.Set(acl, []string{"eth0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ruleset, err := ioutil.ReadFile("tmp/acl.nft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(ruleset), "table inet vyatta-dns-blue {") {
+		t.Fatal("ruleset not written:", string(ruleset))
+	}
+
+	err = c.Set(&AccessControl{DefaultAction: "accept"}, []string{"eth0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"-f tmp/acl.nft",
+		"delete table inet vyatta-dns-blue",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Log("got", calls)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected nft commands")
+	}
+	if _, err := os.Stat("tmp/acl.nft"); !os.IsNotExist(err) {
+		t.Fatal("ruleset file not removed")
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/danos/vyatta-service-dns/internal/fswatcher"
+	"github.com/danos/vyatta-service-dns/internal/log"
+	"github.com/danos/vyatta-service-dns/internal/process"
+)
+
+const blocklistFile = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost.
+{{$addr := .Address -}}
+{{range .Domains -}}
+address=/{{.}}/{{$addr}}
+{{end -}}
+`
+
+var blocklistFileTemplate *template.Template
+
+func init() {
+	t := template.New("BlocklistConf")
+	t.Funcs(template.FuncMap{})
+	blocklistFileTemplate = template.Must(t.Parse(blocklistFile))
+}
+
+type Blocklist struct {
+	Name     string          `rfc7951:"name"`
+	Files    []BlocklistFile `rfc7951:"file,omitempty"`
+	Domains  []string        `rfc7951:"domain,omitempty"`
+	Response string          `rfc7951:"response,omitempty"`
+	// CountHits has dnsmasq log every query, hits are only seen in
+	// its log.
+	CountHits bool `rfc7951:"count-hits,emptyleaf"`
+}
+
+type BlocklistFile struct {
+	Path   string `rfc7951:"path"`
+	Format string `rfc7951:"format,omitempty"`
+}
+
+type BlocklistState struct {
+	Name    string `rfc7951:"name"`
+	Entries uint64 `rfc7951:"entries"`
+	// Hits is only counted for lists that ask for it.
+	Hits *uint64 `rfc7951:"hits,omitempty"`
+}
+
+var blocklistDomainExp = regexp.MustCompile(
+	`^[_a-z0-9]([-_a-z0-9]*[a-z0-9])?(\.[_a-z0-9]([-_a-z0-9]*[a-z0-9])?)*$`)
+
+// Names found in hosts files that are never meant to be blocked,
+// single label names such as localhost are never accepted.
+var blocklistHostsIgnore = map[string]struct{}{
+	"localhost.localdomain": {},
+	"0.0.0.0":               {},
+}
+
+func canonicalDomain(in string) (string, bool) {
+	d := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(in), "."))
+	if !strings.Contains(d, ".") || !blocklistDomainExp.MatchString(d) {
+		return "", false
+	}
+	return d, true
+}
+
+// readBlocklistSource returns the domains listed in r. The hosts
+// format is "address name..." per line, the domain-list format is one
+// domain per line. Anything after a # is a comment.
+func readBlocklistSource(r io.Reader, format string) []string {
+	var out []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if format == "hosts" {
+			fields = fields[1:]
+		} else {
+			fields = fields[:1]
+		}
+		for _, field := range fields {
+			d, ok := canonicalDomain(field)
+			if !ok {
+				continue
+			}
+			if _, ignore := blocklistHostsIgnore[d]; ignore {
+				continue
+			}
+			out = append(out, d)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Dlog.Println("blocklist-read:", err)
+	}
+	return out
+}
+
+type compiledBlocklist struct {
+	name      string
+	address   string
+	domains   []string
+	countHits bool
+}
+
+func labelCount(domain string) int {
+	return strings.Count(domain, ".") + 1
+}
+
+// blockedBy returns the entry of blocked that covers domain, dnsmasq
+// blocks every name below a blocked domain.
+func blockedBy(blocked map[string]int, domain string) (string, int, bool) {
+	for d := domain; ; {
+		if idx, ok := blocked[d]; ok {
+			return d, idx, true
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			return "", 0, false
+		}
+		d = d[i+1:]
+	}
+}
+
+// compileBlocklists reads the sources of lists and removes duplicate
+// entries, both within and across lists. An entry already covered by
+// a parent domain is dropped, the first list in configuration order
+// keeps an entry listed more than once.
+func compileBlocklists(
+	lists []Blocklist,
+	open func(string) (io.ReadCloser, error),
+) []compiledBlocklist {
+	type entry struct {
+		domain string
+		list   int
+	}
+	var entries []entry
+	for i, list := range lists {
+		for _, d := range list.Domains {
+			if d, ok := canonicalDomain(d); ok {
+				entries = append(entries, entry{d, i})
+			}
+		}
+		for _, file := range list.Files {
+			f, err := open(file.Path)
+			if err != nil {
+				log.Dlog.Println("blocklist-compile:", err)
+				continue
+			}
+			for _, d := range readBlocklistSource(f, file.Format) {
+				entries = append(entries, entry{d, i})
+			}
+			f.Close()
+		}
+	}
+	// Shorter names first so that parents are seen before children.
+	sort.SliceStable(entries, func(i, j int) bool {
+		li, lj := labelCount(entries[i].domain), labelCount(entries[j].domain)
+		if li != lj {
+			return li < lj
+		}
+		return entries[i].list < entries[j].list
+	})
+
+	out := make([]compiledBlocklist, len(lists))
+	for i, list := range lists {
+		out[i].name = list.Name
+		out[i].countHits = list.CountHits
+		if list.Response == "null-address" {
+			out[i].address = "#"
+		}
+	}
+	blocked := make(map[string]int)
+	for _, e := range entries {
+		if _, _, ok := blockedBy(blocked, e.domain); ok {
+			continue
+		}
+		blocked[e.domain] = e.list
+		out[e.list].domains = append(out[e.list].domains, e.domain)
+	}
+	for i := range out {
+		sort.Strings(out[i].domains)
+	}
+	return out
+}
+
+func writeBlocklistConfig(w io.Writer, list *compiledBlocklist) error {
+	tmplInput := struct {
+		Address string
+		Domains []string
+	}{
+		Address: list.address,
+		Domains: list.domains,
+	}
+	return blocklistFileTemplate.Execute(w, &tmplInput)
+}
+
+// dnsmasq logs locally answered queries as "config <name> is <answer>"
+// when log-queries is enabled, log-queries=extra adds the serial number
+// and client of the query in front.
+var blocklistHitExp = regexp.MustCompile(`: (?:\d+ \S+ )?config (\S+) is `)
+
+type blocklistCounter struct {
+	name      string
+	entries   uint64
+	hits      uint64
+	countHits bool
+}
+
+type blocklistStats struct {
+	lists []*blocklistCounter
+	index map[string]int
+}
+
+func newBlocklistStats(
+	compiled []compiledBlocklist,
+	old *blocklistStats,
+) *blocklistStats {
+	s := &blocklistStats{index: make(map[string]int)}
+	for i, list := range compiled {
+		counter := &blocklistCounter{
+			name:      list.name,
+			entries:   uint64(len(list.domains)),
+			countHits: list.countHits,
+		}
+		if prev := old.counter(list.name); prev != nil && prev.countHits {
+			counter.hits = atomic.LoadUint64(&prev.hits)
+		}
+		s.lists = append(s.lists, counter)
+		for _, d := range list.domains {
+			s.index[d] = i
+		}
+	}
+	return s
+}
+
+func (s *blocklistStats) counter(name string) *blocklistCounter {
+	if s == nil {
+		return nil
+	}
+	for _, c := range s.lists {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *blocklistStats) readLine(line string) {
+	if s == nil {
+		return
+	}
+	match := blocklistHitExp.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	name, ok := canonicalDomain(match[1])
+	if !ok {
+		return
+	}
+	_, idx, ok := blockedBy(s.index, name)
+	if !ok || !s.lists[idx].countHits {
+		return
+	}
+	atomic.AddUint64(&s.lists[idx].hits, 1)
+}
+
+func (s *blocklistStats) get() []BlocklistState {
+	if s == nil {
+		return nil
+	}
+	out := make([]BlocklistState, 0, len(s.lists))
+	for _, c := range s.lists {
+		state := BlocklistState{
+			Name:    c.name,
+			Entries: c.entries,
+		}
+		if c.countHits {
+			hits := atomic.LoadUint64(&c.hits)
+			state.Hits = &hits
+		}
+		out = append(out, state)
+	}
+	return out
+}
+
+// blocklistConfig compiles the blocklists of an instance into conf-dir
+// fragments and recompiles them whenever one of the sources changes.
+type blocklistConfig struct {
+	mu      sync.Mutex
+	proc    process.Process
+	confDir string
+	lists   []Blocklist
+	watcher *fswatcher.Watcher
+	stats   atomic.Value
+}
+
+func newBlocklistConfig(proc process.Process, confDir string) *blocklistConfig {
+	c := &blocklistConfig{
+		proc:    proc,
+		confDir: confDir,
+	}
+	c.stats.Store((*blocklistStats)(nil))
+	return c
+}
+
+func (c *blocklistConfig) getStats() *blocklistStats {
+	return c.stats.Load().(*blocklistStats)
+}
+
+func (c *blocklistConfig) confFile(name string) string {
+	return filepath.Join(c.confDir, "blocklist-"+name+".conf")
+}
+
+func (c *blocklistConfig) Set(lists []Blocklist) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.watcher != nil {
+		c.watcher.Stop()
+		c.watcher = nil
+	}
+	c.lists = lists
+	if len(lists) == 0 {
+		c.removeStaleConfFiles()
+		c.stats.Store((*blocklistStats)(nil))
+		return nil
+	}
+
+	_, err := c.compile()
+	if err != nil {
+		return err
+	}
+
+	opts := []fswatcher.WatcherOpt{
+		fswatcher.LogPrefix("blocklist watcher:"),
+		fswatcher.Logger(log.Dlog),
+	}
+	for _, list := range lists {
+		for _, file := range list.Files {
+			opts = append(opts, fswatcher.Handler(file.Path, c))
+		}
+	}
+	c.watcher = fswatcher.Start(opts...)
+	return nil
+}
+
+// compile writes the fragments of the current lists and reports
+// whether any of them changed.
+func (c *blocklistConfig) compile() (bool, error) {
+	compiled := compileBlocklists(c.lists,
+		func(path string) (io.ReadCloser, error) {
+			return os.Open(path)
+		})
+	var changed bool
+	for i := range compiled {
+		var buf bytes.Buffer
+		err := writeBlocklistConfig(&buf, &compiled[i])
+		if err != nil {
+			return false, err
+		}
+		file := c.confFile(compiled[i].name)
+		cur, err := ioutil.ReadFile(file)
+		if err == nil && bytes.Equal(cur, buf.Bytes()) {
+			continue
+		}
+		err = ioutil.WriteFile(file, buf.Bytes(), 0644)
+		if err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	if c.removeStaleConfFiles() {
+		changed = true
+	}
+	c.stats.Store(newBlocklistStats(compiled, c.getStats()))
+	return changed, nil
+}
+
+func (c *blocklistConfig) removeStaleConfFiles() bool {
+	keep := make(map[string]struct{})
+	for _, list := range c.lists {
+		keep[c.confFile(list.Name)] = struct{}{}
+	}
+	files, err := filepath.Glob(c.confFile("*"))
+	if err != nil {
+		log.Dlog.Println("blocklist-config:", err)
+		return false
+	}
+	var removed bool
+	for _, file := range files {
+		if _, ok := keep[file]; ok {
+			continue
+		}
+		err := os.Remove(file)
+		if err != nil {
+			log.Dlog.Println("blocklist-config:", err)
+			continue
+		}
+		removed = true
+	}
+	return removed
+}
+
+func (c *blocklistConfig) recompile() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed, err := c.compile()
+	if err != nil || !changed {
+		return err
+	}
+	// The address options are only read when dnsmasq starts.
+	return c.proc.Restart()
+}
+
+func (c *blocklistConfig) CloseWrite(name string) error {
+	return c.recompile()
+}
+
+// Create catches sources that are replaced by renaming a new file
+// over them.
+func (c *blocklistConfig) Create(name string) error {
+	return c.recompile()
+}
+
+func (c *blocklistConfig) Remove(name string) error {
+	return c.recompile()
+}
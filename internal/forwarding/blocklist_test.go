@@ -0,0 +1,143 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadBlocklistSource(t *testing.T) {
+	const hosts = `# hosts style list
+127.0.0.1 localhost
+0.0.0.0 ads.example.com tracker.example.com # trailing comment
+0.0.0.0 Bad_Entry!.example.com
+::1 ip6-localhost
+0.0.0.0 Metrics.Example.NET.
+`
+	const domains = `# one domain per line
+ads.example.org
+  telemetry.example.org   extra fields are ignored
+
+not a domain!
+`
+	got := readBlocklistSource(strings.NewReader(hosts), "hosts")
+	expected := []string{
+		"ads.example.com", "tracker.example.com", "metrics.example.net",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Log("got", got)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected hosts entries")
+	}
+
+	got = readBlocklistSource(strings.NewReader(domains), "domain-list")
+	expected = []string{"ads.example.org", "telemetry.example.org"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Log("got", got)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected domain-list entries")
+	}
+}
+
+func TestCompileBlocklists(t *testing.T) {
+	files := map[string]string{
+		"/lists/ads": "0.0.0.0 ads.example.com\n0.0.0.0 x.ads.example.com\n" +
+			"0.0.0.0 tracker.example.net\n",
+		"/lists/malware": "evil.example.org\ntracker.example.net\n",
+	}
+	open := func(path string) (io.ReadCloser, error) {
+		content, ok := files[path]
+		if !ok {
+			return nil, errors.New("missing " + path)
+		}
+		return ioutil.NopCloser(strings.NewReader(content)), nil
+	}
+	lists := []Blocklist{
+		{
+			Name:    "ads",
+			Files:   []BlocklistFile{{Path: "/lists/ads", Format: "hosts"}},
+			Domains: []string{"sub.evil.example.org"},
+		},
+		{
+			Name: "malware",
+			Files: []BlocklistFile{
+				{Path: "/lists/malware"},
+				{Path: "/lists/missing"},
+			},
+			Response: "null-address",
+		},
+	}
+	got := compileBlocklists(lists, open)
+	expected := []compiledBlocklist{
+		{
+			name:    "ads",
+			domains: []string{"ads.example.com", "tracker.example.net"},
+		},
+		{
+			name:    "malware",
+			address: "#",
+			domains: []string{"evil.example.org"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Log("got", got)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected blocklists")
+	}
+
+	var buf bytes.Buffer
+	err := writeBlocklistConfig(&buf, &got[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expectedConf = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost.
+address=/evil.example.org/#
+`
+	if buf.String() != expectedConf {
+		t.Log("got", buf.String())
+		t.Log("expected", expectedConf)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestBlocklistStatsReadLine(t *testing.T) {
+	old := newBlocklistStats([]compiledBlocklist{
+		{name: "ads", domains: []string{"ads.example.com"}, countHits: true},
+	}, nil)
+	old.readLine("Oct 16 10:00:00 dnsmasq[812]: config ads.example.com is NXDOMAIN")
+
+	stats := newBlocklistStats([]compiledBlocklist{
+		{name: "ads", domains: []string{"ads.example.com", "b.example.com"},
+			countHits: true},
+		{name: "malware", domains: []string{"evil.example.org"}},
+	}, old)
+	const sample = `Oct 16 10:00:01 dnsmasq[812]: query[A] x.ads.example.com from 192.0.2.10
+Oct 16 10:00:01 dnsmasq[812]: config x.ads.example.com is NXDOMAIN
+Oct 16 10:00:02 dnsmasq[812]: config evil.example.org is 0.0.0.0
+Oct 16 10:00:02 dnsmasq[812]: config evil.example.org is ::
+Oct 16 10:00:03 dnsmasq[812]: config web.corp.example is 192.0.2.10
+Oct 16 10:00:04 dnsmasq[812]: reply example.com is 192.0.2.80
+Oct 16 10:00:05 dnsmasq[812]: 12 192.0.2.10/41234 config b.example.com is NXDOMAIN
+`
+	for _, line := range strings.Split(sample, "\n") {
+		stats.readLine(line)
+	}
+	// Hits are only counted for the lists that ask for it.
+	hits := uint64(3)
+	expected := []BlocklistState{
+		{Name: "ads", Entries: 2, Hits: &hits},
+		{Name: "malware", Entries: 1},
+	}
+	if got := stats.get(); !reflect.DeepEqual(got, expected) {
+		t.Log("got", got)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected value")
+	}
+}
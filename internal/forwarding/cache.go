@@ -0,0 +1,79 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"strconv"
+)
+
+// dnsmasq refuses to extend TTLs below this value by more than an
+// hour.
+const maxMinCacheTTL = 3600
+
+// CacheConfigData tunes how long answers are cached. TTLs are in
+// seconds, zero leaves the dnsmasq default in place.
+type CacheConfigData struct {
+	MinTTL          uint32 `rfc7951:"min-ttl,omitempty"`
+	MaxTTL          uint32 `rfc7951:"max-ttl,omitempty"`
+	NegativeTTL     uint32 `rfc7951:"negative-ttl,omitempty"`
+	NoNegativeCache bool   `rfc7951:"no-negative-cache,emptyleaf"`
+	LocalTTL        uint32 `rfc7951:"local-ttl,omitempty"`
+	ServeStale      bool   `rfc7951:"serve-stale,emptyleaf"`
+	// StaleMaxAge limits how long past their expiry answers are
+	// served, in seconds.
+	StaleMaxAge uint32 `rfc7951:"stale-max-age,omitempty"`
+	// Persist refills the cache with the names queried most when
+	// dnsmasq is restarted.
+	Persist bool `rfc7951:"persist,emptyleaf"`
+	// Inspect has dnsmasq log its queries so that the cache can be
+	// looked up and flushed by name.
+	Inspect bool `rfc7951:"inspect,emptyleaf"`
+}
+
+func (c *ConfigData) persistCache() bool {
+	return c.Cache != nil && c.Cache.Persist && c.CacheSize > 0
+}
+
+func (c *ConfigData) inspectCache() bool {
+	return c.Cache != nil && c.Cache.Inspect && c.CacheSize > 0
+}
+
+func (c *ConfigData) validateCache() error {
+	cache := c.Cache
+	if cache == nil {
+		return nil
+	}
+	if c.CacheSize == 0 && (cache.MinTTL != 0 || cache.MaxTTL != 0 ||
+		cache.NegativeTTL != 0 || cache.ServeStale) {
+		return &ConfigError{
+			Path:    "cache",
+			Message: "cache tuning requires a cache-size above 0",
+		}
+	}
+	if cache.MinTTL > maxMinCacheTTL {
+		return &ConfigError{
+			Path: "cache/min-ttl",
+			Message: "cannot exceed " + strconv.Itoa(maxMinCacheTTL) +
+				" seconds",
+		}
+	}
+	if cache.MaxTTL != 0 && cache.MinTTL > cache.MaxTTL {
+		return &ConfigError{
+			Path:    "cache/min-ttl",
+			Message: "cannot exceed max-ttl",
+		}
+	}
+	if cache.NoNegativeCache && cache.NegativeTTL != 0 {
+		return &ConfigError{
+			Path:    "cache/negative-ttl",
+			Message: "cannot be combined with no-negative-cache",
+		}
+	}
+	if !cache.ServeStale && cache.StaleMaxAge != 0 {
+		return &ConfigError{
+			Path:    "cache/stale-max-age",
+			Message: "requires serve-stale",
+		}
+	}
+	return nil
+}
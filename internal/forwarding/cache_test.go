@@ -0,0 +1,150 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteForwardingConfigCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		cache    *CacheConfigData
+		expected string
+	}{
+		{
+			name: "all",
+			cache: &CacheConfigData{
+				MinTTL:      60,
+				MaxTTL:      86400,
+				NegativeTTL: 30,
+				LocalTTL:    300,
+				ServeStale:  true,
+				StaleMaxAge: 3600,
+			},
+			expected: `min-cache-ttl=60
+max-cache-ttl=86400
+neg-ttl=30
+local-ttl=300
+use-stale-cache=3600
+`,
+		},
+		{
+			name: "no-negative-cache",
+			cache: &CacheConfigData{
+				NoNegativeCache: true,
+				ServeStale:      true,
+			},
+			expected: `no-negcache
+use-stale-cache
+`,
+		},
+		{
+			name:  "defaults",
+			cache: &CacheConfigData{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := &ConfigData{
+				CacheSize:        150,
+				ListenInterfaces: []string{"eth0"},
+				Cache:            test.cache,
+			}
+			var buf bytes.Buffer
+			err := NewConfig().writeForwardingConfig(&buf, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+` + test.expected + `no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+			if buf.String() != expected {
+				t.Log("got", buf.String())
+				t.Log("expected", expected)
+				t.Fatal("didn't get expected output")
+			}
+		})
+	}
+}
+
+func TestValidateCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheSize uint32
+		cache     CacheConfigData
+		path      string
+	}{
+		{
+			name:      "valid",
+			cacheSize: 150,
+			cache: CacheConfigData{
+				MinTTL:     60,
+				MaxTTL:     3600,
+				ServeStale: true,
+			},
+		},
+		{
+			name:      "cache-disabled",
+			cacheSize: 0,
+			cache:     CacheConfigData{ServeStale: true},
+			path:      "cache",
+		},
+		{
+			name:      "min-ttl-too-large",
+			cacheSize: 150,
+			cache:     CacheConfigData{MinTTL: 7200},
+			path:      "cache/min-ttl",
+		},
+		{
+			name:      "min-ttl-above-max-ttl",
+			cacheSize: 150,
+			cache:     CacheConfigData{MinTTL: 600, MaxTTL: 300},
+			path:      "cache/min-ttl",
+		},
+		{
+			name:      "negative-ttl-without-negative-cache",
+			cacheSize: 150,
+			cache:     CacheConfigData{NegativeTTL: 60, NoNegativeCache: true},
+			path:      "cache/negative-ttl",
+		},
+		{
+			name:      "stale-max-age-without-serve-stale",
+			cacheSize: 150,
+			cache:     CacheConfigData{StaleMaxAge: 60},
+			path:      "cache/stale-max-age",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := &ConfigData{
+				CacheSize: test.cacheSize,
+				Cache:     &test.cache,
+			}
+			err := conf.validateCache()
+			if test.path == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			cerr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatal("expected a ConfigError, got", err)
+			}
+			if cerr.Path != test.path {
+				t.Fatal("unexpected path", cerr.Path)
+			}
+		})
+	}
+}
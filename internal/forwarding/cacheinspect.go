@@ -0,0 +1,401 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+// dnsmasq can neither be asked for a single cache entry nor drop one.
+// On SIGUSR1 it logs the whole cache when it logs queries, so entries
+// are looked up in that dump. Flushing clears the whole cache and
+// queries up to warmNames of the other names again, the entries of
+// truncated names are lost and the refilled ones get fresh TTLs.
+const (
+	// cacheDumpTimeout is how long dnsmasq has to start the dump.
+	cacheDumpTimeout = 2 * time.Second
+	// The dump is complete once no entry was logged for this long.
+	cacheDumpIdle = 200 * time.Millisecond
+	// cacheDumpMaxDuration bounds the whole dump, a dump that takes
+	// longer is interleaved with too many other lines to be trusted.
+	cacheDumpMaxDuration = 30 * time.Second
+	// dnsmasq truncates the names in the dump to this length.
+	cacheDumpNameLen = 30
+)
+
+// Entries are logged as "<name> <answer> <flags> <expires>", the flags
+// are the type of the entry followed by one column per flag.
+var (
+	cacheDumpHeaderExp = regexp.MustCompile(`: Host +Address +Flags +Expires$`)
+	cacheDumpEntryExp  = regexp.MustCompile(
+		`: (\S+) +(\S*) +([46CVKS ][F ][R ][I ][D ][N ][X ][H ][C ][V ]) ` +
+			`(PERMANENT|\w{3} \w{3} [ \d]\d \d\d:\d\d:\d\d \d{4})$`)
+)
+
+// CacheEntry is an answer in the cache of dnsmasq.
+type CacheEntry struct {
+	Name   string `rfc7951:"name"`
+	Type   string `rfc7951:"type"`
+	Answer string `rfc7951:"answer,omitempty"`
+	// TTL is the time in seconds until the entry expires, permanent
+	// entries have none.
+	TTL       *uint32 `rfc7951:"ttl,omitempty"`
+	Permanent bool    `rfc7951:"permanent,emptyleaf"`
+	// Negative is nodata or nxdomain for cached negative answers.
+	Negative string `rfc7951:"negative,omitempty"`
+}
+
+func (e *CacheEntry) matches(name string, subdomains bool) bool {
+	if e.Name == name {
+		return true
+	}
+	return subdomains && strings.HasSuffix(e.Name, "."+name)
+}
+
+// mayMatch reports whether the entry may be for name. The full name of
+// a truncated entry isn't known.
+func (e *CacheEntry) mayMatch(name string) bool {
+	if e.matches(name, false) {
+		return true
+	}
+	return len(e.Name) == cacheDumpNameLen &&
+		strings.HasPrefix(name, e.Name)
+}
+
+func cacheEntryType(flags string) string {
+	switch flags[0] {
+	case '4':
+		if flags[2] == 'R' && flags[1] != 'F' {
+			return "PTR"
+		}
+		return "A"
+	case '6':
+		if flags[2] == 'R' && flags[1] != 'F' {
+			return "PTR"
+		}
+		return "AAAA"
+	case 'C':
+		return "CNAME"
+	case 'V':
+		return "SRV"
+	case 'K':
+		return "DNSKEY"
+	case 'S':
+		return "DS"
+	}
+	return ""
+}
+
+func parseCacheEntry(line string, now time.Time) (CacheEntry, bool) {
+	match := cacheDumpEntryExp.FindStringSubmatch(line)
+	if match == nil {
+		return CacheEntry{}, false
+	}
+	name, answer, flags, expires := match[1], match[2], match[3], match[4]
+	entry := CacheEntry{
+		Name:   strings.ToLower(name),
+		Type:   cacheEntryType(flags),
+		Answer: answer,
+	}
+	switch {
+	case flags[6] == 'X':
+		entry.Negative = "nxdomain"
+	case flags[5] == 'N':
+		entry.Negative = "nodata"
+	}
+	if expires == "PERMANENT" {
+		entry.Permanent = true
+		return entry, true
+	}
+	t, err := time.ParseInLocation(time.ANSIC, expires, time.Local)
+	if err != nil {
+		return CacheEntry{}, false
+	}
+	var ttl uint32
+	if d := t.Sub(now); d > 0 {
+		ttl = uint32(d / time.Second)
+	}
+	entry.TTL = &ttl
+	return entry, true
+}
+
+// cacheDump collects the entries dnsmasq logs after SIGUSR1.
+type cacheDump struct {
+	mu      sync.Mutex
+	now     time.Time
+	started bool
+	// incomplete is set when lines of the dump may have been lost.
+	incomplete  bool
+	entries     []CacheEntry
+	logged      chan struct{}
+	timeout     time.Duration
+	idle        time.Duration
+	maxDuration time.Duration
+}
+
+func newCacheDump(now time.Time) *cacheDump {
+	return &cacheDump{
+		now:         now,
+		logged:      make(chan struct{}, 1),
+		timeout:     cacheDumpTimeout,
+		idle:        cacheDumpIdle,
+		maxDuration: cacheDumpMaxDuration,
+	}
+}
+
+func (d *cacheDump) readLine(line string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case cacheDumpHeaderExp.MatchString(line):
+		d.started = true
+	case !d.started:
+		return
+	default:
+		entry, ok := parseCacheEntry(line, d.now)
+		if !ok {
+			return
+		}
+		d.entries = append(d.entries, entry)
+	}
+	select {
+	case d.logged <- struct{}{}:
+	default:
+	}
+}
+
+// truncated is called when the log was truncated, the entries logged
+// in between may be lost.
+func (d *cacheDump) truncated() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started {
+		d.incomplete = true
+	}
+}
+
+func (d *cacheDump) wait() ([]CacheEntry, error) {
+	select {
+	case <-d.logged:
+	case <-time.After(d.timeout):
+		return nil, errors.New("timed out waiting for the cache contents")
+	}
+	deadline := time.After(d.maxDuration)
+	for {
+		select {
+		case <-d.logged:
+		case <-deadline:
+			return nil, errors.New(
+				"timed out waiting for the end of the cache contents")
+		case <-time.After(d.idle):
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.incomplete {
+				return nil, errors.New(
+					"the log was truncated while the cache contents " +
+						"were logged, try again")
+			}
+			return d.entries, nil
+		}
+	}
+}
+
+func (c *Config) getCacheDump() *cacheDump {
+	return c.cacheDump.Load().(*cacheDump)
+}
+
+// dumpCache returns the entries in the cache of dnsmasq.
+func (c *Config) dumpCache() ([]CacheEntry, error) {
+	if conf := c.Get(); conf == nil || !conf.inspectCache() {
+		return nil, errors.New("cache inspection is not enabled")
+	}
+	c.cacheDumpMu.Lock()
+	defer c.cacheDumpMu.Unlock()
+	d := newCacheDump(time.Now())
+	c.cacheDump.Store(d)
+	defer c.cacheDump.Store((*cacheDump)(nil))
+	err := c.forwardingProcess.Signal(syscall.SIGUSR1)
+	if err != nil {
+		return nil, err
+	}
+	return d.wait()
+}
+
+// lookupCache returns the entries cached for name.
+func (c *Config) lookupCache(name string) ([]CacheEntry, error) {
+	entries, err := c.dumpCache()
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	var out []CacheEntry
+	for _, e := range entries {
+		if e.mayMatch(name) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// reverseName returns the name PTR records for ip are queried at.
+func reverseName(ip net.IP) string {
+	var b strings.Builder
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := len(ip4) - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(ip4[i])))
+			b.WriteString(".")
+		}
+		b.WriteString("in-addr.arpa")
+		return b.String()
+	}
+	const hex = "0123456789abcdef"
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
+
+// refillNames returns up to warmNames names to query again to put the
+// entries back into the cache. Only forwarded answers are queried, the
+// cache holds CNAMEs as part of the answer to an address query.
+// Truncated names can't be queried, their entries are lost.
+func refillNames(entries []CacheEntry) []warmName {
+	seen := make(map[warmName]struct{})
+	var out []warmName
+	for _, e := range entries {
+		if e.Permanent || len(e.Name) == cacheDumpNameLen {
+			continue
+		}
+		n := warmName{Name: e.Name}
+		switch e.Type {
+		case "A", "CNAME":
+			n.Qtype = dnsclient.TypeA
+		case "AAAA":
+			n.Qtype = dnsclient.TypeAAAA
+		case "SRV":
+			n.Qtype = dnsclient.TypeSRV
+		case "PTR":
+			ip := net.ParseIP(e.Answer)
+			if ip == nil {
+				continue
+			}
+			n = warmName{Name: reverseName(ip), Qtype: dnsclient.TypePTR}
+		default:
+			continue
+		}
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		out = append(out, n)
+		if len(out) == warmNames {
+			break
+		}
+	}
+	return out
+}
+
+// cacheRefill queries the names left after a flush in the background.
+type cacheRefill struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (r *cacheRefill) cancel() {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+}
+
+// startCacheRefill queries names to put them back into the cache, a
+// refill that is still running is stopped first.
+func (c *Config) startCacheRefill(names []warmName) {
+	c.cacheRefillMu.Lock()
+	defer c.cacheRefillMu.Unlock()
+	c.cacheRefill.cancel()
+	r := &cacheRefill{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	warmer := newCacheWarmer("", c.localServer(), relayDevice(c.instance))
+	go func() {
+		defer close(r.done)
+		warmer.replay(names, r.stop)
+	}()
+	c.cacheRefill = r
+}
+
+// stopCacheRefill stops the refill of a flush, e.g. because dnsmasq is
+// reconfigured.
+func (c *Config) stopCacheRefill() {
+	c.cacheRefillMu.Lock()
+	defer c.cacheRefillMu.Unlock()
+	c.cacheRefill.cancel()
+	c.cacheRefill = nil
+}
+
+// splitFlushed counts the entries flushed for name and returns the
+// others.
+func splitFlushed(
+	entries []CacheEntry,
+	name string,
+	subdomains bool,
+) (uint32, []CacheEntry) {
+	var flushed uint32
+	var keep []CacheEntry
+	for _, e := range entries {
+		if e.matches(name, subdomains) {
+			flushed++
+			continue
+		}
+		keep = append(keep, e)
+	}
+	return flushed, keep
+}
+
+// flushCache drops the entries cached for name, and for the names
+// below it when subdomains is set. It returns the number of entries
+// flushed, entries whose names were truncated in the dump aren't
+// counted although they are dropped too.
+func (c *Config) flushCache(name string, subdomains bool) (uint32, error) {
+	entries, err := c.dumpCache()
+	if err != nil {
+		return 0, err
+	}
+	flushed, keep := splitFlushed(entries,
+		strings.ToLower(strings.TrimSuffix(name, ".")), subdomains)
+	if flushed == 0 {
+		return 0, nil
+	}
+	c.stopCacheRefill()
+	err = c.forwardingProcess.Signal(syscall.SIGHUP)
+	if err != nil {
+		return 0, err
+	}
+	c.startCacheRefill(refillNames(keep))
+	log.Dlog.Println("forwarding-cache-flush: flushed", flushed,
+		"entries for", name)
+	return flushed, nil
+}
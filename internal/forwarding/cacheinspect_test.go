@@ -0,0 +1,202 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+)
+
+const cacheDumpSample = `Oct 16 10:00:00 dnsmasq[812]: time 1792144800
+Oct 16 10:00:00 dnsmasq[812]: cache size 150, 0/4 cache insertions re-used unexpired cache entries.
+Oct 16 10:00:00 dnsmasq[812]: Host                                     Address                        Flags      Expires
+Oct 16 10:00:00 dnsmasq[812]: www.example.com                93.184.216.34                            4F         Fri Oct 16 10:05:00 2026
+Oct 16 10:00:00 dnsmasq[812]: example.com                    www.example.com                          CF         Fri Oct 16 10:01:40 2026
+Oct 16 10:00:00 dnsmasq[812]: missing.example.com                                                     4F   NX    Fri Oct 16 10:00:30 2026
+Oct 16 10:00:00 dnsmasq[812]: router.lan                     192.0.2.1                                4FRI   H   PERMANENT
+Oct 16 10:00:00 dnsmasq[812]: a.very.long.name.below.example 2001:db8::1                              6F         Fri Oct 16 10:02:00 2026
+Oct 16 10:00:00 dnsmasq[812]: example.org                    2001:db8::2                              6F         Fri Oct 16 10:02:00 2026
+Oct 16 10:00:00 dnsmasq[812]: host.example.net               192.0.2.10                               4 R        Fri Oct 16 10:03:00 2026
+`
+
+func uint32Ptr(v uint32) *uint32 {
+	return &v
+}
+
+func readCacheDumpSample(t *testing.T) []CacheEntry {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.Local)
+	d := newCacheDump(now)
+	d.idle = time.Millisecond
+	for _, line := range strings.Split(cacheDumpSample, "\n") {
+		d.readLine(line)
+	}
+	entries, err := d.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestCacheDump(t *testing.T) {
+	entries := readCacheDumpSample(t)
+	expected := []CacheEntry{
+		{Name: "www.example.com", Type: "A", Answer: "93.184.216.34",
+			TTL: uint32Ptr(300)},
+		{Name: "example.com", Type: "CNAME", Answer: "www.example.com",
+			TTL: uint32Ptr(100)},
+		{Name: "missing.example.com", Type: "A", TTL: uint32Ptr(30),
+			Negative: "nxdomain"},
+		{Name: "router.lan", Type: "A", Answer: "192.0.2.1",
+			Permanent: true},
+		{Name: "a.very.long.name.below.example", Type: "AAAA",
+			Answer: "2001:db8::1", TTL: uint32Ptr(120)},
+		{Name: "example.org", Type: "AAAA", Answer: "2001:db8::2",
+			TTL: uint32Ptr(120)},
+		{Name: "host.example.net", Type: "PTR", Answer: "192.0.2.10",
+			TTL: uint32Ptr(180)},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Log("got", entries)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected entries")
+	}
+}
+
+func TestCacheDumpTimeout(t *testing.T) {
+	d := newCacheDump(time.Now())
+	d.timeout = 10 * time.Millisecond
+	// Lines logged before the dump are ignored.
+	d.readLine("Oct 16 10:00:00 dnsmasq[812]: example.com                    192.0.2.1                                4F         Fri Oct 16 10:05:00 2026")
+	_, err := d.wait()
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+}
+
+func TestCacheDumpTruncated(t *testing.T) {
+	d := newCacheDump(time.Now())
+	d.idle = time.Millisecond
+	lines := strings.Split(cacheDumpSample, "\n")
+	// Truncation before the dump loses nothing of it.
+	d.truncated()
+	for _, line := range lines[:4] {
+		d.readLine(line)
+	}
+	d.truncated()
+	for _, line := range lines[4:] {
+		d.readLine(line)
+	}
+	entries, err := d.wait()
+	if err == nil {
+		t.Fatal("expected an error for an incomplete dump, got", entries)
+	}
+}
+
+func TestCacheDumpMaxDuration(t *testing.T) {
+	d := newCacheDump(time.Now())
+	d.idle = 50 * time.Millisecond
+	d.maxDuration = 20 * time.Millisecond
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, line := range strings.Split(cacheDumpSample, "\n") {
+				d.readLine(line)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	_, err := d.wait()
+	if err == nil {
+		t.Fatal("expected an error for a dump that doesn't end")
+	}
+}
+
+func TestCacheEntryMatches(t *testing.T) {
+	entries := readCacheDumpSample(t)
+	var names []string
+	for _, e := range entries {
+		if e.matches("example.com", true) {
+			names = append(names, e.Name)
+		}
+	}
+	expected := []string{"www.example.com", "example.com",
+		"missing.example.com"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatal("unexpected matches", names)
+	}
+
+	// Truncated names may match the names they may have been cut
+	// from, but never match them.
+	long := entries[4]
+	if !long.mayMatch("a.very.long.name.below.example.com") {
+		t.Fatal("truncated entry doesn't match its name")
+	}
+	if long.matches("a.very.long.name.below.example.com", false) {
+		t.Fatal("truncated entry matches its name")
+	}
+	if long.mayMatch("example.com") {
+		t.Fatal("truncated entry matches unrelated name")
+	}
+}
+
+func TestSplitFlushed(t *testing.T) {
+	entries := readCacheDumpSample(t)
+	flushed, keep := splitFlushed(entries,
+		"a.very.long.name.below.example.com", false)
+	if flushed != 0 {
+		t.Fatal("truncated entry reported as flushed")
+	}
+	if len(keep) != len(entries) {
+		t.Fatal("unexpected entries kept", keep)
+	}
+
+	flushed, keep = splitFlushed(entries, "example.com", true)
+	if flushed != 3 {
+		t.Fatal("expected 3 entries flushed, got", flushed)
+	}
+	if len(keep) != len(entries)-3 {
+		t.Fatal("unexpected entries kept", keep)
+	}
+}
+
+func TestRefillNames(t *testing.T) {
+	names := refillNames(readCacheDumpSample(t))
+	expected := []warmName{
+		{Name: "www.example.com", Qtype: dnsclient.TypeA},
+		{Name: "example.com", Qtype: dnsclient.TypeA},
+		{Name: "missing.example.com", Qtype: dnsclient.TypeA},
+		{Name: "example.org", Qtype: dnsclient.TypeAAAA},
+		{Name: "10.2.0.192.in-addr.arpa", Qtype: dnsclient.TypePTR},
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatal("unexpected names", names)
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	got := reverseName(net.ParseIP("2001:db8::1"))
+	const expected = "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"
+	if got != expected {
+		t.Fatal("got", got, "expected", expected)
+	}
+}
+
+func TestDumpCacheNotEnabled(t *testing.T) {
+	conf := NewConfig()
+	conf.currentConfig.Store(&ConfigData{CacheSize: 150})
+	_, err := conf.dumpCache()
+	if err == nil {
+		t.Fatal("cache dumped without inspection enabled")
+	}
+}
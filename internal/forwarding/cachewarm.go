@@ -0,0 +1,295 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+// dnsmasq can't hand over its cache to a new process. Instead the
+// names clients query most are tracked from the query log, written to
+// a snapshot before dnsmasq is restarted and queried again once it is
+// back so that they are cached before clients ask for them.
+const (
+	// warmNames is the number of names kept in a snapshot.
+	warmNames = 1000
+	// warmTracked bounds the names tracked between snapshots, the
+	// counts are halved when it is reached.
+	warmTracked = 10 * warmNames
+	// warmStartTimeout is how long the restarted dnsmasq has to
+	// answer the first query.
+	warmStartTimeout = 5 * time.Second
+	warmTimeout      = 2 * time.Second
+	warmLocalServer  = "127.0.0.1:53"
+)
+
+// dnsmasq logs every query as "query[<type>] <name> from <client>",
+// optionally preceded by the serial number and client of the query.
+var warmQueryExp = regexp.MustCompile(
+	`: (?:\d+ \S+ )?query\[([A-Z]+)\] (\S+) from `)
+
+type warmName struct {
+	Name  string
+	Qtype uint16
+}
+
+type cacheWarmer struct {
+	mu       sync.Mutex
+	file     string
+	counts   map[warmName]uint64
+	restored uint64
+	query    func(name string, qtype uint16) error
+	sleep    func(time.Duration)
+}
+
+func newCacheWarmer(file, server, device string) *cacheWarmer {
+	client := &dnsclient.Client{
+		Timeout: warmTimeout,
+		Device:  device,
+	}
+	return &cacheWarmer{
+		file:   file,
+		counts: make(map[warmName]uint64),
+		query: func(name string, qtype uint16) error {
+			_, _, err := client.Exchange(
+				dnsclient.NewQuery(name, qtype, dnsclient.ClassINET),
+				server)
+			return err
+		},
+		sleep: time.Sleep,
+	}
+}
+
+func (w *cacheWarmer) readLine(line string) {
+	if w == nil {
+		return
+	}
+	match := warmQueryExp.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	qtype, ok := dnsclient.StringType(match[1])
+	if !ok || qtype == dnsclient.TypeANY {
+		return
+	}
+	name := strings.ToLower(strings.TrimSuffix(match[2], "."))
+	if name == "" {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := warmName{Name: name, Qtype: qtype}
+	if _, ok := w.counts[key]; !ok && len(w.counts) >= warmTracked {
+		w.decay()
+	}
+	w.counts[key]++
+}
+
+// decay halves all counts, names that were queried once are dropped.
+func (w *cacheWarmer) decay() {
+	for key, count := range w.counts {
+		if count <= 1 {
+			delete(w.counts, key)
+			continue
+		}
+		w.counts[key] = count / 2
+	}
+}
+
+// hot returns the most queried names, most queried first.
+func (w *cacheWarmer) hot() []warmName {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]warmName, 0, len(w.counts))
+	for key := range w.counts {
+		out = append(out, key)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ci, cj := w.counts[out[i]], w.counts[out[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Qtype < out[j].Qtype
+	})
+	if len(out) > warmNames {
+		out = out[:warmNames]
+	}
+	return out
+}
+
+func writeWarmSnapshot(w io.Writer, names []warmName) error {
+	for _, n := range names {
+		_, err := fmt.Fprintln(w, n.Name, dnsclient.TypeString(n.Qtype))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readWarmSnapshot(r io.Reader) []warmName {
+	var out []warmName
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		qtype, ok := dnsclient.StringType(fields[1])
+		if !ok {
+			continue
+		}
+		out = append(out, warmName{Name: fields[0], Qtype: qtype})
+	}
+	return out
+}
+
+// snapshot writes the hot names to the snapshot file. The previous
+// snapshot is kept when no queries were seen since it was written,
+// e.g. when the service itself was restarted.
+func (w *cacheWarmer) snapshot() {
+	if w == nil {
+		return
+	}
+	names := w.hot()
+	if len(names) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	err := writeWarmSnapshot(&buf, names)
+	if err == nil {
+		_, err = writeFileIfChanged(w.file, buf.Bytes())
+	}
+	if err != nil {
+		log.Dlog.Println("forwarding-cache-warm:", err)
+	}
+}
+
+// warm queries the names of the snapshot, it is called after dnsmasq
+// was restarted.
+func (w *cacheWarmer) warm() {
+	if w == nil {
+		return
+	}
+	f, err := os.Open(w.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Dlog.Println("forwarding-cache-warm:", err)
+		}
+		return
+	}
+	names := readWarmSnapshot(f)
+	f.Close()
+	atomic.AddUint64(&w.restored, w.replay(names, nil))
+}
+
+// replay queries names and returns how many were answered. It gives up
+// early once stop is closed.
+func (w *cacheWarmer) replay(names []warmName, stop <-chan struct{}) uint64 {
+	if len(names) == 0 {
+		return 0
+	}
+
+	// Wait for the new process to answer before replaying the rest.
+	var err error
+	deadline := time.Now().Add(warmStartTimeout)
+	for {
+		err = w.query(names[0].Name, names[0].Qtype)
+		if err == nil || time.Now().After(deadline) || stopped(stop) {
+			break
+		}
+		w.sleep(warmStartTimeout / 10)
+	}
+	if err != nil {
+		log.Dlog.Println("forwarding-cache-warm:", err)
+		return 0
+	}
+	restored := uint64(1)
+	for _, n := range names[1:] {
+		if stopped(stop) {
+			break
+		}
+		if w.query(n.Name, n.Qtype) == nil {
+			restored++
+		}
+	}
+	log.Dlog.Println("forwarding-cache-warm: restored", restored, "of",
+		len(names), "names")
+	return restored
+}
+
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *cacheWarmer) entriesRestored() uint64 {
+	if w == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&w.restored)
+}
+
+func (c *Config) getCacheWarmer() *cacheWarmer {
+	return c.cacheWarmer.Load().(*cacheWarmer)
+}
+
+func (c *Config) updateCacheWarmer(conf *ConfigData) {
+	if conf == nil || !conf.persistCache() {
+		c.cacheWarmer.Store((*cacheWarmer)(nil))
+		err := os.Remove(c.cachesnapshotfile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Dlog.Println("forwarding-cache-warm:", err)
+		}
+		return
+	}
+	if c.getCacheWarmer() != nil {
+		return
+	}
+	c.cacheWarmer.Store(newCacheWarmer(c.cachesnapshotfile,
+		c.localServer(), relayDevice(c.instance)))
+}
+
+// localServer is the address names are queried from dnsmasq at.
+func (c *Config) localServer() string {
+	if c.statsserver == "" {
+		return warmLocalServer
+	}
+	return c.statsserver
+}
+
+// restart restarts dnsmasq, keeping the names most queried in its
+// cache when cache persistence is enabled.
+func (c *Config) restart() error {
+	warmer := c.getCacheWarmer()
+	warmer.snapshot()
+	err := c.forwardingProcess.Restart()
+	if err != nil {
+		return err
+	}
+	if warmer != nil {
+		go warmer.warm()
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+)
+
+func TestCacheWarmerHot(t *testing.T) {
+	const sample = `Oct 16 10:00:01 dnsmasq[812]: query[A] example.com from 192.0.2.10
+Oct 16 10:00:01 dnsmasq[812]: forwarded example.com to 8.8.8.8
+Oct 16 10:00:02 dnsmasq[812]: query[AAAA] Example.com. from 192.0.2.10
+Oct 16 10:00:03 dnsmasq[812]: query[A] att.com from 192.0.2.11
+Oct 16 10:00:04 dnsmasq[812]: query[A] att.com from 192.0.2.12
+Oct 16 10:00:05 dnsmasq[812]: query[ANY] att.com from 192.0.2.12
+Oct 16 10:00:06 dnsmasq[812]: query[TYPE65] att.com from 192.0.2.12
+`
+	w := newCacheWarmer("tmp/cache-snapshot", "127.0.0.1:53", "")
+	for _, line := range strings.Split(sample, "\n") {
+		w.readLine(line)
+	}
+	expected := []warmName{
+		{Name: "att.com", Qtype: dnsclient.TypeA},
+		{Name: "example.com", Qtype: dnsclient.TypeA},
+		{Name: "example.com", Qtype: dnsclient.TypeAAAA},
+	}
+	if hot := w.hot(); !reflect.DeepEqual(hot, expected) {
+		t.Fatal("unexpected hot names", hot)
+	}
+
+	w.decay()
+	expected = []warmName{
+		{Name: "att.com", Qtype: dnsclient.TypeA},
+	}
+	if hot := w.hot(); !reflect.DeepEqual(hot, expected) {
+		t.Fatal("unexpected hot names after decay", hot)
+	}
+}
+
+func TestCacheWarmerSnapshotAndWarm(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("tmp")
+
+	w := newCacheWarmer("tmp/cache-snapshot", "127.0.0.1:53", "")
+	for _, line := range []string{
+		"dnsmasq[812]: query[A] att.com from 192.0.2.10",
+		"dnsmasq[812]: query[A] att.com from 192.0.2.10",
+		"dnsmasq[812]: query[MX] att.com from 192.0.2.10",
+		"dnsmasq[812]: query[A] broken.example from 192.0.2.10",
+	} {
+		w.readLine(line)
+	}
+	w.snapshot()
+	data, err := ioutil.ReadFile("tmp/cache-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expectedSnapshot = `att.com A
+att.com MX
+broken.example A
+`
+	if string(data) != expectedSnapshot {
+		t.Fatal("unexpected snapshot", string(data))
+	}
+
+	// The first query fails until the restarted process is up.
+	var queried []string
+	starting := 2
+	w.sleep = func(time.Duration) {}
+	w.query = func(name string, qtype uint16) error {
+		queried = append(queried, name+" "+dnsclient.TypeString(qtype))
+		if starting > 0 {
+			starting--
+			return errors.New("connection refused")
+		}
+		if name == "broken.example" {
+			return errors.New("timeout")
+		}
+		return nil
+	}
+	w.warm()
+	expectedQueries := []string{
+		"att.com A", "att.com A", "att.com A", "att.com MX", "broken.example A",
+	}
+	if !reflect.DeepEqual(queried, expectedQueries) {
+		t.Fatal("unexpected queries", queried)
+	}
+	if restored := w.entriesRestored(); restored != 2 {
+		t.Fatal("unexpected entries restored", restored)
+	}
+}
+
+func TestCacheWarmerReplayStop(t *testing.T) {
+	w := newCacheWarmer("", "127.0.0.1:53", "")
+	stop := make(chan struct{})
+	var queried []string
+	w.query = func(name string, qtype uint16) error {
+		queried = append(queried, name)
+		if len(queried) == 2 {
+			close(stop)
+		}
+		return nil
+	}
+	restored := w.replay([]warmName{
+		{Name: "att.com", Qtype: dnsclient.TypeA},
+		{Name: "example.com", Qtype: dnsclient.TypeA},
+		{Name: "example.org", Qtype: dnsclient.TypeA},
+	}, stop)
+	if restored != 2 || len(queried) != 2 {
+		t.Fatal("replay didn't stop, queried", queried)
+	}
+}
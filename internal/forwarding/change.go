@@ -0,0 +1,237 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/danos/vyatta-service-dns/internal/log"
+	"github.com/danos/vyatta-service-dns/internal/process"
+)
+
+// changeAction is what dnsmasq needs to pick up a configuration change.
+type changeAction int
+
+const (
+	changeNone changeAction = iota
+	// changeReload has dnsmasq re-read its hosts files and the
+	// servers file.
+	changeReload
+	// changeRestart is needed for everything else, dnsmasq reads its
+	// configuration file and conf-dir only when it starts.
+	changeRestart
+)
+
+func (a changeAction) String() string {
+	switch a {
+	case changeNone:
+		return "none"
+	case changeReload:
+		return "reload"
+	default:
+		return "restart"
+	}
+}
+
+// dnsmasqProcess is restarted and reloaded by configuration changes as
+// well as by the watchers of learned name servers and the health
+// checker. It serialises them and keeps track of whether dnsmasq runs
+// with the files on disk, a change is only classified against them
+// when it does.
+type dnsmasqProcess struct {
+	process.Process
+	mu      sync.Mutex
+	running bool
+}
+
+func (p *dnsmasqProcess) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.Process.Start()
+	p.running = err == nil
+	return err
+}
+
+func (p *dnsmasqProcess) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = false
+	return p.Process.Stop()
+}
+
+func (p *dnsmasqProcess) Restart() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.Process.Restart()
+	p.running = err == nil
+	return err
+}
+
+func (p *dnsmasqProcess) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.Process.Reload()
+	if err != nil {
+		p.running = false
+	}
+	return err
+}
+
+func (p *dnsmasqProcess) isRunning() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+// forget has the next change restart dnsmasq, the files on disk are
+// not the ones it runs with.
+func (p *dnsmasqProcess) forget() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = false
+}
+
+// configSnapshot holds the contents of the files rendered for dnsmasq,
+// a missing file has no entry.
+type configSnapshot struct {
+	restart map[string][]byte
+	reload  map[string][]byte
+}
+
+func snapshotFiles(files []string) map[string][]byte {
+	out := make(map[string][]byte)
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		out[file] = data
+	}
+	return out
+}
+
+func sameFiles(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, data := range a {
+		other, ok := b[file]
+		if !ok || !bytes.Equal(data, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshotConfiguration reads the files dnsmasq is configured with.
+// Options that only concern the service itself, such as the access
+// control list or the TLS proxy, never show up in them.
+func (c *Config) snapshotConfiguration() configSnapshot {
+	restart := []string{c.conffile, c.envfile}
+	for _, ext := range c.confdirext {
+		files, err := filepath.Glob(filepath.Join(c.confdir, ext))
+		if err != nil {
+			log.Dlog.Println("forwarding-config-snapshot:", err)
+			continue
+		}
+		restart = append(restart, files...)
+	}
+	return configSnapshot{
+		restart: snapshotFiles(restart),
+		reload:  snapshotFiles([]string{c.statichostsfile, c.serversfile}),
+	}
+}
+
+// classifyChange compares the files rendered before and after a
+// configuration change.
+func classifyChange(before, after configSnapshot) changeAction {
+	switch {
+	case !sameFiles(before.restart, after.restart):
+		return changeRestart
+	case !sameFiles(before.reload, after.reload):
+		return changeReload
+	default:
+		return changeNone
+	}
+}
+
+// restoreFiles writes the files of previous back and removes those
+// that were added since.
+func restoreFiles(current, previous map[string][]byte) error {
+	for file := range current {
+		if _, ok := previous[file]; ok {
+			continue
+		}
+		err := os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for file, data := range previous {
+		_, err := writeFileIfChanged(file, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreConfiguration puts back the files dnsmasq was configured with
+// before a change failed, and has dnsmasq pick them up again when it
+// was running.
+func (c *Config) restoreConfiguration(before configSnapshot, wasRunning bool) {
+	const logPrefix = "forwarding-config-restore:"
+	after := c.snapshotConfiguration()
+	action := classifyChange(before, after)
+	if action == changeNone {
+		return
+	}
+	err := restoreFiles(after.restart, before.restart)
+	if err == nil {
+		err = restoreFiles(after.reload, before.reload)
+	}
+	if err != nil {
+		log.Elog.Println(logPrefix, err)
+		c.forwardingProcess.forget()
+		return
+	}
+	if !wasRunning {
+		return
+	}
+	log.Dlog.Println(logPrefix, "restored files need", action)
+	switch action {
+	case changeRestart:
+		err = c.restart()
+	case changeReload:
+		err = c.forwardingProcess.Reload()
+	}
+	if err != nil {
+		// The next change restarts it.
+		log.Elog.Println(logPrefix, err)
+	}
+}
+
+// apply has dnsmasq pick up the change from before. dnsmasq is always
+// restarted the first time a configuration is applied, it may not be
+// running yet.
+func (c *Config) apply(before configSnapshot) error {
+	action := changeRestart
+	if c.forwardingProcess.isRunning() {
+		action = classifyChange(before, c.snapshotConfiguration())
+	}
+	log.Dlog.Println("forwarding-config-set: change needs", action)
+	switch action {
+	case changeRestart:
+		return c.restart()
+	case changeReload:
+		return c.forwardingProcess.Reload()
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/process"
+)
+
+func TestClassifyChange(t *testing.T) {
+	err := os.MkdirAll("tmp/dnsmasq.d", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("tmp")
+	conf := newTestConfig()
+	write := func(file, data string) {
+		err := ioutil.WriteFile(file, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("tmp/dnsmasq.conf", "cache-size=150\n")
+	write("tmp/static-hosts", "192.0.2.1\trouter\n")
+
+	tests := []struct {
+		name     string
+		change   func()
+		expected changeAction
+	}{
+		{
+			name:     "unchanged",
+			change:   func() { write("tmp/dnsmasq.conf", "cache-size=150\n") },
+			expected: changeNone,
+		},
+		{
+			name:     "hosts",
+			change:   func() { write("tmp/static-hosts", "192.0.2.2\trouter\n") },
+			expected: changeReload,
+		},
+		{
+			name:     "servers-file",
+			change:   func() { write("tmp/servers.conf", "server=192.0.2.53\n") },
+			expected: changeReload,
+		},
+		{
+			name:     "config",
+			change:   func() { write("tmp/dnsmasq.conf", "cache-size=300\n") },
+			expected: changeRestart,
+		},
+		{
+			name: "fragment",
+			change: func() {
+				write("tmp/dnsmasq.d/dhcpinterface-eth0.conf",
+					"server=192.0.2.53\n")
+			},
+			expected: changeRestart,
+		},
+		{
+			name:     "fragment-removed",
+			change:   func() { os.Remove("tmp/dnsmasq.d/dhcpinterface-eth0.conf") },
+			expected: changeRestart,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := conf.snapshotConfiguration()
+			test.change()
+			action := classifyChange(before, conf.snapshotConfiguration())
+			if action != test.expected {
+				t.Fatal("expected", test.expected, "got", action)
+			}
+		})
+	}
+}
+
+func TestConfigObjectSetRestartsOnlyWhenNeeded(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log")
+	conf := newTestConfig(processConstructor(
+		func(string) process.Process {
+			return proc
+		}))
+	expectAction := func(expected string) {
+		t.Helper()
+		select {
+		case act := <-proc.actions:
+			if act != expected {
+				t.Fatalf("%s expected, got %s", expected, act)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("timeout waiting for %s", expected)
+		}
+	}
+	expectNoAction := func() {
+		t.Helper()
+		select {
+		case act := <-proc.actions:
+			t.Fatal("unexpected", act)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	data := &ConfigData{
+		CacheSize:          150,
+		ListenInterfaces:   []string{"eth0"},
+		Nameservers:        []string{"8.8.8.8"},
+		StaticHostMappings: testStaticHostMappings,
+	}
+	err = conf.Set(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAction("Restart")
+
+	// The static hosts file is re-read on reload.
+	err = conf.Set(&ConfigData{
+		CacheSize:          150,
+		ListenInterfaces:   []string{"eth0"},
+		Nameservers:        []string{"8.8.8.8"},
+		StaticHostMappings: testStaticHostMappings[:1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNoAction()
+
+	err = conf.Set(&ConfigData{
+		CacheSize:          300,
+		ListenInterfaces:   []string{"eth0"},
+		Nameservers:        []string{"8.8.8.8"},
+		StaticHostMappings: testStaticHostMappings[:1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAction("Restart")
+}
+
+func TestConfigObjectSetRestartsAfterFailedRestart(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := &failingTproc{
+		tproc: newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log"),
+	}
+	conf := newTestConfig(processConstructor(
+		func(string) process.Process {
+			return proc
+		}))
+	err = conf.Set(&ConfigData{
+		CacheSize:          150,
+		ListenInterfaces:   []string{"eth0"},
+		Nameservers:        []string{"8.8.8.8"},
+		StaticHostMappings: testStaticHostMappings,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A watcher of learned name servers fails to restart dnsmasq.
+	proc.fail = true
+	if conf.forwardingProcess.Restart() == nil {
+		t.Fatal("expected restart failure")
+	}
+	if conf.forwardingProcess.isRunning() {
+		t.Fatal("dnsmasq still considered running")
+	}
+
+	// A change that would only need a reload restarts it.
+	proc.fail = false
+	proc.restarts = nil
+	err = conf.Set(&ConfigData{
+		CacheSize:          150,
+		ListenInterfaces:   []string{"eth0"},
+		Nameservers:        []string{"8.8.8.8"},
+		StaticHostMappings: testStaticHostMappings[:1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proc.restarts) != 1 || !conf.forwardingProcess.isRunning() {
+		t.Fatal("dnsmasq not restarted", len(proc.restarts))
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+const dnsmasqBinary = "/usr/sbin/dnsmasq"
+
+// Check renders the proposed configuration, together with the name
+// server fragments that would currently be derived from DHCP and the
+// system resolver, into a scratch directory and has dnsmasq test it.
+// Problems found before dnsmasq is run are returned as a *ConfigError.
+func (c *Config) Check(conf *ConfigData) error {
+	if conf == nil {
+		return nil
+	}
+
+	err := conf.validateLocalZones()
+	if err != nil {
+		return err
+	}
+	err = conf.validateDomainOverrides()
+	if err != nil {
+		return err
+	}
+	err = conf.validateNameserverParameters()
+	if err != nil {
+		return err
+	}
+	err = conf.validateCache()
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "dnsmasq-check-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	scratch := c.scratchConfig(dir)
+	err = os.MkdirAll(scratch.confdir, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = c.writeCheckFragments(scratch.confdir, conf)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(scratch.conffile)
+	if err != nil {
+		return err
+	}
+	err = scratch.writeForwardingConfig(f, conf)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.checkCmd(scratch.conffile)
+}
+
+// scratchConfig returns a Config that renders the configuration of
+// the instance into dir. Everything else the rendered files refer to
+// is kept, dnsmasq reads some of them while testing.
+func (c *Config) scratchConfig(dir string) *Config {
+	return &Config{
+		instance:         c.instance,
+		conffile:         filepath.Join(dir, "dnsmasq.conf"),
+		confdir:          filepath.Join(dir, "dnsmasq.d"),
+		confdirext:       c.confdirext,
+		statefile:        c.statefile,
+		hostsfile:        c.hostsfile,
+		statichostsfile:  c.statichostsfile,
+		trustanchorsfile: c.trustanchorsfile,
+		serversfile:      c.serversfile,
+	}
+}
+
+func (c *Config) writeCheckFragments(confdir string, conf *ConfigData) error {
+	err := writeCheckDhcpFragments(confdir, conf.DHCPInterfaces,
+		c.dhcpwatchpattern, c.dhcpconffilepattern, renderDhcpConfig)
+	if err != nil {
+		return err
+	}
+	err = writeCheckDhcpFragments(confdir, conf.DHCPv6Interfaces,
+		c.dhcp6watchpattern, c.dhcp6confpattern, renderDhcpv6Config)
+	if err != nil {
+		return err
+	}
+
+	if !conf.System {
+		return nil
+	}
+	resolv, err := os.Open(c.resolvfile)
+	if err != nil {
+		return nil
+	}
+	ns := readSystemNameservers(resolv)
+	resolv.Close()
+	return writeCheckFragment(
+		filepath.Join(confdir, filepath.Base(c.systemconffile)),
+		func(f *os.File) error {
+			return writeDnsmasqSystemConfig(f, ns)
+		})
+}
+
+func writeCheckDhcpFragments(
+	confdir string,
+	interfaces []string,
+	watchFmt, confFileFmt string,
+	render dhcpRenderer,
+) error {
+	for _, intf := range interfaces {
+		lease, err := os.Open(fmt.Sprintf(watchFmt, intf))
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(fmt.Sprintf(confFileFmt, intf))
+		err = writeCheckFragment(filepath.Join(confdir, name),
+			func(f *os.File) error {
+				return render(f, intf, lease)
+			})
+		lease.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCheckFragment(name string, write func(*os.File) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return write(f)
+}
+
+func testDnsmasqConfig(conffile string) error {
+	if _, err := os.Stat(dnsmasqBinary); err != nil {
+		// Nothing to validate with, let the commit proceed.
+		log.Dlog.Println("forwarding-config-check:", err)
+		return nil
+	}
+	out, err := exec.Command(dnsmasqBinary, "--test", "-C", conffile).
+		CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	msg := strings.TrimSpace(string(out))
+	if msg == "" {
+		return err
+	}
+	msg = strings.Replace(msg, conffile, "generated configuration", -1)
+	return errors.New(msg)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func checkCommand(cmd func(string) error) ConfigOption {
+	//This option is needed for testing but not externally for now
+	return func(c *Config) {
+		c.checkCmd = cmd
+	}
+}
+
+func TestConfigCheckRendersFragments(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	const dhcpData = `
+new_domain_name_servers='1.1.1.1 2.2.2.2'
+`
+	err = ioutil.WriteFile("tmp/dhclient_eth0_lease", []byte(dhcpData), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const resolvData = `
+nameserver 3.3.3.3 # system added by vyatta-system-nameservers
+`
+	err = ioutil.WriteFile("tmp/resolv.conf", []byte(resolvData), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checked string
+	var fragments []string
+	conf := newTestConfig(checkCommand(func(conffile string) error {
+		buf, err := ioutil.ReadFile(conffile)
+		if err != nil {
+			return err
+		}
+		checked = string(buf)
+		files, _ := filepath.Glob(filepath.Join(
+			filepath.Dir(conffile), "dnsmasq.d", "*.conf"))
+		for _, file := range files {
+			buf, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			fragments = append(fragments, string(buf))
+		}
+		return nil
+	}))
+	data := &ConfigData{
+		CacheSize:        150,
+		DHCPInterfaces:   []string{"eth0"},
+		ListenInterfaces: []string{"eth1"},
+		System:           true,
+	}
+	err = conf.Check(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(checked, "cache-size=150\n") {
+		t.Fatal("dnsmasq configuration was not rendered:", checked)
+	}
+	if len(fragments) != 2 {
+		t.Fatal("expected dhcp and system fragments, got", fragments)
+	}
+	if !strings.Contains(fragments[0], "server=1.1.1.1\t# dhcp eth0") {
+		t.Fatal("didn't get expected dhcp fragment:", fragments[0])
+	}
+	if !strings.Contains(fragments[1], "server=3.3.3.3\t# system") {
+		t.Fatal("didn't get expected system fragment:", fragments[1])
+	}
+
+	// Nothing must be written to the real configuration locations
+	_, err = os.Stat("tmp/dnsmasq.conf")
+	if !os.IsNotExist(err) {
+		t.Fatal("check wrote the live configuration file")
+	}
+}
+
+func TestConfigCheckReportsFailure(t *testing.T) {
+	conf := newTestConfig(checkCommand(func(string) error {
+		return errors.New("bad option at line 5")
+	}))
+	err := conf.Check(&ConfigData{CacheSize: 150})
+	if err == nil || err.Error() != "bad option at line 5" {
+		t.Fatal("expected check failure, got", err)
+	}
+}
+
+func TestConfigCheckRendersLiveConfiguration(t *testing.T) {
+	var checked, scratchDir string
+	conf := newTestConfig(
+		TrustAnchorsFile("tmp/trust-anchors.conf"),
+		checkCommand(func(conffile string) error {
+			buf, err := ioutil.ReadFile(conffile)
+			if err != nil {
+				return err
+			}
+			checked = string(buf)
+			scratchDir = filepath.Dir(conffile)
+			return nil
+		}))
+	// Validation without trust anchors uses the ones of the
+	// trust anchors file.
+	data := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth1"},
+		Nameservers:      []string{"8.8.8.8"},
+		HealthCheck:      &HealthCheck{},
+		DNSSEC:           &DNSSECConfigData{Validate: true},
+	}
+	err := conf.Check(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(checked, "conf-file=tmp/trust-anchors.conf\n") {
+		t.Fatal("trust anchors file not rendered:", checked)
+	}
+
+	var live bytes.Buffer
+	err = conf.writeForwardingConfig(&live, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the rendered files are elsewhere.
+	expected := strings.NewReplacer(
+		"resolv-file=tmp/dnsmasq.conf\n",
+		"resolv-file="+filepath.Join(scratchDir, "dnsmasq.conf")+"\n",
+		"conf-dir=tmp/dnsmasq.d,",
+		"conf-dir="+filepath.Join(scratchDir, "dnsmasq.d")+",",
+	).Replace(live.String())
+	if checked != expected {
+		t.Log("got", checked)
+		t.Log("expected", expected)
+		t.Fatal("checked configuration differs from the live one")
+	}
+}
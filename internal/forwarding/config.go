@@ -7,9 +7,12 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"text/template"
+	"time"
 
 	"github.com/danos/vyatta-service-dns/internal/fswatcher"
 	"github.com/danos/vyatta-service-dns/internal/log"
@@ -26,17 +29,94 @@ edns-packet-max=4096
 interface={{.}}
 {{end -}}
 cache-size={{.Conf.CacheSize}}
-{{range .Conf.Nameservers -}}
-server={{.}}	# statically configured
+{{with .Conf.Cache -}}
+{{with .MinTTL}}min-cache-ttl={{.}}
+{{end -}}
+{{with .MaxTTL}}max-cache-ttl={{.}}
+{{end -}}
+{{if .NoNegativeCache -}}
+no-negcache
+{{else}}{{with .NegativeTTL}}neg-ttl={{.}}
+{{end}}{{end -}}
+{{with .LocalTTL}}local-ttl={{.}}
+{{end -}}
+{{if .ServeStale}}use-stale-cache{{with .StaleMaxAge}}={{.}}{{end}}
+{{end -}}
+{{end -}}
+{{with .Conf.DNSSEC}}{{if .Validate -}}
+dnssec
+{{range .TrustAnchors -}}
+trust-anchor={{.}}
+{{else -}}
+conf-file={{$.TrustAnchorsFile}}
+{{end -}}
+{{if eq .CheckUnsigned "disabled" -}}
+dnssec-check-unsigned=no
+{{else -}}
+dnssec-check-unsigned
+{{end -}}
+{{end}}{{end -}}
+{{if .QueryLogExtra -}}
+log-queries=extra
+{{else if .LogQueries -}}
+log-queries
+{{end -}}
+{{if eq .Conf.ForwardingPolicy "strict-order" -}}
+strict-order
+{{else if eq .Conf.ForwardingPolicy "all-servers" -}}
+all-servers
+{{end -}}
+{{range .Upstreams -}}
+{{if .ServersFile -}}
+servers-file={{$.ServersFile}}
+{{else if .TLS -}}
+server={{$.TLSProxyAddress}}	# tls-proxy{{range $.TLSNameservers}} {{.Address}}{{end}}
+{{else if .Relay -}}
+server={{$.RelayAddress}}#{{.Relay.Port}}	# relay {{.Relay.RoutingInstance}} {{.Relay.Address}}
+{{else -}}
+server={{.Address}}	# statically configured
+{{end -}}
 {{end -}}
 {{range .Conf.DomainOverrides -}}
-server=/{{.Domain}}/{{.Server}}	# domain-override
+{{$override := . -}}
+{{if .LocalOnly -}}
+server=/{{.Domain}}/	# domain-override local-only
+{{else -}}
+{{range .Servers -}}
+server=/{{$override.Domain}}/{{overrideServer . $override}}	# domain-override
+{{end -}}
+{{end -}}
+{{end -}}
+{{range .Conf.LocalZones -}}
+{{$zone := .Name -}}
+local=/{{$zone}}/
+{{range .Hosts -}}
+host-record={{fqdn .Name $zone}},{{join .Addresses ","}}
+{{end -}}
+{{range .CNAMEs -}}
+cname={{fqdn .Name $zone}},{{.Target}}
+{{end -}}
+{{range .MXs -}}
+mx-host={{fqdn .Name $zone}},{{.Exchange}},{{.Preference}}
+{{end -}}
+{{range .SRVs -}}
+srv-host={{srv . $zone}}
+{{end -}}
+{{range .TXTs -}}
+txt-record={{fqdn .Name $zone}},{{txt .Values}}
+{{end -}}
+{{range .PTRs -}}
+ptr-record={{fqdn .Name $zone}},{{.Target}}
+{{end -}}
 {{end -}}
 {{if .UseForwardingConf -}}
 resolv-file={{.ForwardingConf}}
 {{end -}}
 no-hosts
 addn-hosts={{.HostsFile}}
+{{if .Conf.StaticHostMappings -}}
+addn-hosts={{.StaticHostsFile}}
+{{end -}}
 conf-dir={{.ConfDir}},{{.ConfDirExt}}
 `
 const envFile = `### Autogenerated by vyatta-service-dns
@@ -49,7 +129,13 @@ var envFileTemplate *template.Template
 
 func init() {
 	t := template.New("ForwardingConf")
-	t.Funcs(template.FuncMap{})
+	t.Funcs(template.FuncMap{
+		"fqdn":           zoneFQDN,
+		"join":           strings.Join,
+		"overrideServer": overrideServer,
+		"srv":            srvRecord,
+		"txt":            txtStrings,
+	})
 	cfgFileTemplate = template.Must(t.Parse(cfgFile))
 	t = template.New("ForwardingEnv")
 	t.Funcs(template.FuncMap{})
@@ -58,19 +144,79 @@ func init() {
 
 type ConfigData struct {
 	DHCPInterfaces   []string `rfc7951:"dhcp,omitempty"`
+	DHCPv6Interfaces []string `rfc7951:"dhcpv6,omitempty"`
+	SLAACInterfaces  []string `rfc7951:"slaac,omitempty"`
 	CacheSize        uint32   `rfc7951:"cache-size"`
 	ListenInterfaces []string `rfc7951:"listen-on,omitempty"`
 	Nameservers      []string `rfc7951:"name-server,omitempty"`
 	System           bool     `rfc7951:"system,emptyleaf"`
 
-	DomainOverrides []struct {
-		Domain string `rfc7951:"tagnode"`
-		Server string `rfc7951:"server"`
-	} `rfc7951:"domain,omitempty"`
+	NameserverParameters []NameserverParameters `rfc7951:"name-server-parameters,omitempty"`
+
+	StaticHostMappings []StaticHostMapping `rfc7951:"static-host-mapping,omitempty"`
+	LocalZones         []LocalZone         `rfc7951:"local-zone,omitempty"`
+	Blocklists         []Blocklist         `rfc7951:"blocklist,omitempty"`
+
+	AccessControl *AccessControl `rfc7951:"access-control,omitempty"`
+
+	ForwardingPolicy string `rfc7951:"forwarding-policy,omitempty"`
+
+	HealthCheck *HealthCheck `rfc7951:"health-check,omitempty"`
+
+	Cache *CacheConfigData `rfc7951:"cache,omitempty"`
+
+	QueryLog   *QueryLog   `rfc7951:"query-log,omitempty"`
+	TopTalkers *TopTalkers `rfc7951:"top-talkers,omitempty"`
+
+	DNSSEC *DNSSECConfigData `rfc7951:"dnssec,omitempty"`
+
+	DomainOverrides []DomainOverride `rfc7951:"domain,omitempty"`
+}
+
+type DomainOverride struct {
+	Domain          string   `rfc7951:"tagnode"`
+	Servers         []string `rfc7951:"server,omitempty"`
+	Port            uint16   `rfc7951:"port,omitempty"`
+	SourceAddress   string   `rfc7951:"source-address,omitempty"`
+	SourceInterface string   `rfc7951:"source-interface,omitempty"`
+	LocalOnly       bool     `rfc7951:"local-only,emptyleaf"`
 }
 
 func (c *ConfigData) nsDerivedFromConf() bool {
-	return len(c.DHCPInterfaces) > 0 || len(c.Nameservers) > 0 || c.System
+	return len(c.DHCPInterfaces) > 0 || len(c.DHCPv6Interfaces) > 0 ||
+		len(c.SLAACInterfaces) > 0 || len(c.Nameservers) > 0 || c.System
+}
+
+func (c *ConfigData) dnssecValidate() bool {
+	return c.DNSSEC != nil && c.DNSSEC.Validate
+}
+
+func (c *ConfigData) dnssecStatistics() bool {
+	return c.dnssecValidate() && c.DNSSEC.Statistics
+}
+
+func (c *ConfigData) countBlocklistHits() bool {
+	for _, list := range c.Blocklists {
+		if list.CountHits {
+			return true
+		}
+	}
+	return false
+}
+
+// logQueries reports whether dnsmasq needs to log every query, the
+// log is followed to derive what dnsmasq doesn't report otherwise.
+// Every query is then written to the log and parsed again, so each of
+// these is asked for explicitly.
+func (c *ConfigData) logQueries() bool {
+	return c.dnssecStatistics() || c.countBlocklistHits() ||
+		c.persistCache() || c.queryLogExtra() || c.inspectCache()
+}
+
+// queryLogExtra reports whether the queries logged by dnsmasq are
+// parsed into records, which needs the serial number of each query.
+func (c *ConfigData) queryLogExtra() bool {
+	return c.QueryLog != nil || c.TopTalkers != nil
 }
 
 type ConfigOption func(*Config)
@@ -124,6 +270,24 @@ func DHCPWatchFmt(pattern string) ConfigOption {
 	}
 }
 
+func DHCPv6ConfigFileFmt(pattern string) ConfigOption {
+	return func(c *Config) {
+		c.dhcp6confpattern = pattern
+	}
+}
+
+func DHCPv6WatchFmt(pattern string) ConfigOption {
+	return func(c *Config) {
+		c.dhcp6watchpattern = pattern
+	}
+}
+
+func SLAACConfigFileFmt(pattern string) ConfigOption {
+	return func(c *Config) {
+		c.slaacconfpattern = pattern
+	}
+}
+
 func SystemConfigFile(file string) ConfigOption {
 	return func(c *Config) {
 		c.systemconffile = file
@@ -142,6 +306,73 @@ func HostsFile(file string) ConfigOption {
 	}
 }
 
+// StaticHostsFile is where the static host mappings of the instance
+// are written.
+func StaticHostsFile(file string) ConfigOption {
+	return func(c *Config) {
+		c.statichostsfile = file
+	}
+}
+
+// StatsServer is the host:port on which the dnsmasq instance answers
+// CHAOS class statistics queries. When unset statistics are read from
+// the dnsmasq log after signalling the process.
+func StatsServer(addr string) ConfigOption {
+	return func(c *Config) {
+		c.statsserver = addr
+	}
+}
+
+func TLSProxyUnit(unit string) ConfigOption {
+	return func(c *Config) {
+		c.tlsproxyunit = unit
+	}
+}
+
+func TLSProxyConfigFile(file string) ConfigOption {
+	return func(c *Config) {
+		c.tlsproxyconffile = file
+	}
+}
+
+// ACLFile is where the nftables ruleset enforcing the access control
+// list of the instance is written.
+func ACLFile(file string) ConfigOption {
+	return func(c *Config) {
+		c.aclfile = file
+	}
+}
+
+// ServersFile is where the statically configured name servers are
+// written while they are health checked.
+func ServersFile(file string) ConfigOption {
+	return func(c *Config) {
+		c.serversfile = file
+	}
+}
+
+// CacheSnapshotFile is where the names queried most are kept while
+// dnsmasq is restarted.
+func CacheSnapshotFile(file string) ConfigOption {
+	return func(c *Config) {
+		c.cachesnapshotfile = file
+	}
+}
+
+// QueryLogFile is where queries are exported to when the query log
+// is written to a file.
+func QueryLogFile(file string) ConfigOption {
+	return func(c *Config) {
+		c.querylogfile = file
+	}
+}
+
+func TrustAnchorsFile(file string) ConfigOption {
+	return func(c *Config) {
+		c.trustanchorsfile = file
+	}
+}
+
 func InstanceName(name string) ConfigOption {
 	return func(c *Config) {
 		c.instance = name
@@ -168,12 +399,33 @@ func VRFHelpers(sub process.VRFSubscriber, chk process.VRFChecker) ConfigOption
 
 type Config struct {
 	currentConfig atomic.Value
+	dnssec        atomic.Value
+	cacheWarmer   atomic.Value
+	queryLogger   atomic.Value
+	topTalkers    atomic.Value
+	queryParser   *queryLogParser
+	cacheDump     atomic.Value
+	cacheDumpMu   sync.Mutex
+	stateDump     atomic.Value
+	stateDumpMu   sync.Mutex
+	cacheRefillMu sync.Mutex
+	cacheRefill   *cacheRefill
 
 	dhcpConfig        *dhcpConfig
+	dhcpv6Config      *dhcpConfig
+	slaacConfig       *slaacConfig
 	systemConfig      *systemConfig
+	tlsProxyConfig    *tlsProxyConfig
+	relayConfig       *relayConfig
+	blocklistConfig   *blocklistConfig
+	aclConfig         *aclConfig
+	health            *healthChecker
+	healthReload      *reloadLimiter
+	serversFile       *serversFileConfig
 	resolvWatcher     *reloadWatcher
 	hostsWatcher      *reloadWatcher
-	forwardingProcess process.Process
+	forwardingProcess *dnsmasqProcess
+	logTail           *logTail
 
 	// options
 	instance            string
@@ -187,13 +439,30 @@ type Config struct {
 	statefile           string
 	dhcpwatchpattern    string
 	dhcpconffilepattern string
+	dhcp6watchpattern   string
+	dhcp6confpattern    string
+	slaacconfpattern    string
 	systemconffile      string
 	resolvfile          string
 	hostsfile           string
+	statichostsfile     string
+	statsserver         string
+	trustanchorsfile    string
+	tlsproxyunit        string
+	tlsproxyconffile    string
+	aclfile             string
+	serversfile         string
+	cachesnapshotfile   string
+	querylogfile        string
 	pCons               func(string) process.Process
+	checkCmd            func(string) error
 
 	vrfSub process.VRFSubscriber
 	vrfChk process.VRFChecker
+
+	notifier   Notifier
+	notifyMu   sync.Mutex
+	lastActive []ActiveNameserver
 }
 
 func NewInstanceConfig(name string, opts ...ConfigOption) *Config {
@@ -208,6 +477,8 @@ func NewInstanceConfig(name string, opts ...ConfigOption) *Config {
 		ConfigFile(fmt.Sprintf("%s/dnsmasq.conf", instanceDir)),
 		ConfigDir(fmt.Sprintf("%s/dnsmasq.d", instanceDir), "*.conf"),
 		DHCPConfigFileFmt(fmt.Sprintf("%s/dnsmasq.d/dhcpinterface-%%s.conf", instanceDir)),
+		DHCPv6ConfigFileFmt(fmt.Sprintf("%s/dnsmasq.d/dhcpv6interface-%%s.conf", instanceDir)),
+		SLAACConfigFileFmt(fmt.Sprintf("%s/dnsmasq.d/slaacinterface-%%s.conf", instanceDir)),
 		SystemConfigFile(fmt.Sprintf("%s/dnsmasq.d/system.conf", instanceDir)),
 
 		PIDFile(fmt.Sprintf("%s/dnsmasq.pid", instanceDir)),
@@ -215,6 +486,14 @@ func NewInstanceConfig(name string, opts ...ConfigOption) *Config {
 
 		ResolvFile(fmt.Sprintf("%s/resolv.conf", instanceDir)),
 		HostsFile(fmt.Sprintf("%s/hosts", instanceDir)),
+		StaticHostsFile(fmt.Sprintf("%s/static-hosts", instanceDir)),
+		StatsServer("127.0.0.1:53"),
+		TLSProxyUnit(fmt.Sprintf("stubby@%s.service", name)),
+		TLSProxyConfigFile(fmt.Sprintf("%s/stubby.yml", instanceDir)),
+		ACLFile(fmt.Sprintf("%s/acl.nft", instanceDir)),
+		ServersFile(fmt.Sprintf("%s/servers.conf", instanceDir)),
+		CacheSnapshotFile(fmt.Sprintf("%s/cache-snapshot", instanceDir)),
+		QueryLogFile(fmt.Sprintf("/var/log/dnsmasq-queries-%s.json", name)),
 	}
 	//Allow user options to override default instance options by appending them to the list
 	iopts = append(iopts, opts...)
@@ -234,9 +513,20 @@ func NewConfig(opts ...ConfigOption) *Config {
 		pidfile              = "/var/run/dnsmasq/dnsmasq.pid"
 		resolvfile           = "/etc/resolv.conf"
 		hostsfile            = "/etc/hosts"
+		staticHostsFile      = "/run/dns/static-hosts"
 		systemNameserverConf = "/etc/dnsmasq.d/system.conf"
 		dhcpWatchPattern     = "/var/lib/dhcp/dhclient_%s_lease"
 		dhcpConffileTemplate = "/etc/dnsmasq.d/dhcpinterface-%s.conf"
+		dhcp6WatchPattern    = "/var/lib/dhcp/dhclient_v6_%s_lease"
+		dhcp6ConffileFmt     = "/etc/dnsmasq.d/dhcpv6interface-%s.conf"
+		slaacConffileFmt     = "/etc/dnsmasq.d/slaacinterface-%s.conf"
+		trustAnchorsFile     = "/usr/share/dnsmasq-base/trust-anchors.conf"
+		tlsProxyUnit         = "stubby.service"
+		tlsProxyConfFile     = "/etc/stubby/stubby.yml"
+		aclFile              = "/run/dns/acl.nft"
+		serversFile          = "/run/dns/servers.conf"
+		cacheSnapshotFile    = "/run/dns/cache-snapshot"
+		queryLogFile         = "/var/log/dnsmasq-queries.json"
 	)
 
 	conf := &Config{
@@ -249,10 +539,22 @@ func NewConfig(opts ...ConfigOption) *Config {
 		unit:                unit,
 		dhcpwatchpattern:    dhcpWatchPattern,
 		dhcpconffilepattern: dhcpConffileTemplate,
+		dhcp6watchpattern:   dhcp6WatchPattern,
+		dhcp6confpattern:    dhcp6ConffileFmt,
+		slaacconfpattern:    slaacConffileFmt,
 		systemconffile:      systemNameserverConf,
 		resolvfile:          resolvfile,
 		hostsfile:           hostsfile,
+		statichostsfile:     staticHostsFile,
+		trustanchorsfile:    trustAnchorsFile,
+		tlsproxyunit:        tlsProxyUnit,
+		tlsproxyconffile:    tlsProxyConfFile,
+		aclfile:             aclFile,
+		serversfile:         serversFile,
+		cachesnapshotfile:   cacheSnapshotFile,
+		querylogfile:        queryLogFile,
 		pCons:               process.NewSystemdProcess,
+		checkCmd:            testDnsmasqConfig,
 	}
 
 	// run options to change the defaults
@@ -260,18 +562,55 @@ func NewConfig(opts ...ConfigOption) *Config {
 		opt(conf)
 	}
 
-	conf.forwardingProcess = conf.pCons(conf.unit)
+	conf.forwardingProcess = &dnsmasqProcess{Process: conf.pCons(conf.unit)}
 	conf.dhcpConfig = &dhcpConfig{
 		proc:        conf.forwardingProcess,
 		watchFmt:    conf.dhcpwatchpattern,
 		confFileFmt: conf.dhcpconffilepattern,
+		render:      renderDhcpConfig,
+		notify:      conf.notifyNameservers,
 	}
+	conf.dhcpv6Config = &dhcpConfig{
+		proc:        conf.forwardingProcess,
+		watchFmt:    conf.dhcp6watchpattern,
+		confFileFmt: conf.dhcp6confpattern,
+		render:      renderDhcpv6Config,
+		notify:      conf.notifyNameservers,
+	}
+	conf.slaacConfig = newSLAACConfig(conf.forwardingProcess,
+		conf.slaacconfpattern, conf.notifyNameservers)
 	conf.systemConfig = &systemConfig{
 		proc:      conf.forwardingProcess,
 		watchFile: conf.resolvfile,
 		confFile:  conf.systemconffile,
+		notify:    conf.notifyNameservers,
+	}
+	conf.blocklistConfig = newBlocklistConfig(conf.forwardingProcess,
+		conf.confdir)
+	conf.aclConfig = &aclConfig{
+		instance: conf.instance,
+		file:     conf.aclfile,
+		nft:      runNft,
+	}
+	conf.relayConfig = &relayConfig{instance: conf.instance}
+	conf.health = newHealthChecker(conf.nameserverHealthChanged)
+	conf.healthReload = newReloadLimiter(healthReloadHoldDown,
+		conf.applyHealthyNameservers)
+	conf.serversFile = &serversFileConfig{file: conf.serversfile}
+	conf.tlsProxyConfig = &tlsProxyConfig{
+		newProc: func() process.Process {
+			return conf.pCons(conf.tlsproxyunit)
+		},
+		confFile: conf.tlsproxyconffile,
 	}
 	conf.currentConfig.Store(&ConfigData{})
+	conf.dnssec.Store((*dnssecStats)(nil))
+	conf.cacheWarmer.Store((*cacheWarmer)(nil))
+	conf.queryLogger.Store((*queryLogger)(nil))
+	conf.topTalkers.Store((*topTalkers)(nil))
+	conf.cacheDump.Store((*cacheDump)(nil))
+	conf.stateDump.Store((*stateDump)(nil))
+	conf.queryParser = &queryLogParser{instance: conf.instance, now: time.Now}
 	return conf
 }
 
@@ -285,19 +624,30 @@ func (c *Config) Set(conf *ConfigData) error {
 	if reflect.DeepEqual(old, conf) {
 		return nil
 	}
+	c.stopCacheRefill()
 	if conf != nil {
-		err := c.updateConfiguration(conf)
+		before := c.snapshotConfiguration()
+		wasRunning := c.forwardingProcess.isRunning()
+		err := c.updateConfiguration(conf, before)
 		if err != nil {
+			log.Elog.Println(logPrefix, err)
+			c.restoreConfiguration(before, wasRunning)
+			// Parts of conf other than the files, such as the
+			// relays, may be in place. Record it so that setting
+			// the previous configuration again is not mistaken
+			// for a no-op.
+			c.currentConfig.Store(conf)
 			return err
 		}
 	} else {
 		c.deleteConfiguration()
 	}
 	c.currentConfig.Store(conf)
+	c.notifyNameservers()
 	return nil
 }
 
-func (c *Config) updateConfiguration(conf *ConfigData) error {
+func (c *Config) updateConfiguration(conf *ConfigData, before configSnapshot) error {
 	err := c.ensureEnvironment()
 	if err != nil {
 		return err
@@ -333,24 +683,67 @@ func (c *Config) updateConfiguration(conf *ConfigData) error {
 		c.resolvWatcher.stop()
 		c.resolvWatcher = nil
 	} else if c.resolvWatcher == nil {
-		c.resolvWatcher = startReloadWatcher(
+		c.resolvWatcher = startReloadWatcher("resolv watcher:",
 			c.resolvfile, c.forwardingProcess)
 	}
 
 	if c.hostsWatcher == nil {
-		c.hostsWatcher = startReloadWatcher(
+		c.hostsWatcher = startReloadWatcher("hosts watcher:",
 			c.hostsfile, c.forwardingProcess)
 	}
 
+	err = c.updateStaticHosts(conf)
+	if err != nil {
+		return err
+	}
+
 	c.dhcpConfig.Set(conf.DHCPInterfaces)
+	c.dhcpv6Config.Set(conf.DHCPv6Interfaces)
+	err = c.slaacConfig.Set(conf.SLAACInterfaces)
+	if err != nil {
+		return err
+	}
 
 	c.systemConfig.Set(conf.System)
 
-	err = c.forwardingProcess.Restart()
+	err = c.relayConfig.Set(conf.relayedNameservers(c.instance))
 	if err != nil {
 		return err
 	}
-	return nil
+
+	err = c.tlsProxyConfig.Set(conf.tlsNameservers())
+	if err != nil {
+		return err
+	}
+
+	err = c.blocklistConfig.Set(conf.Blocklists)
+	if err != nil {
+		return err
+	}
+
+	err = c.aclConfig.Set(conf.AccessControl, conf.ListenInterfaces)
+	if err != nil {
+		return err
+	}
+
+	err = c.updateHealthCheck(conf)
+	if err != nil {
+		return err
+	}
+
+	c.updateDNSSECStats(conf)
+	c.updateCacheWarmer(conf)
+	c.updateQueryLogger(conf)
+	c.updateTopTalkers(conf)
+	if !conf.logQueries() {
+		c.logTail.stop()
+		c.logTail = nil
+	} else if c.logTail == nil {
+		c.logTail = startLogTail(c.statefile, c.readLogLine,
+			c.logTruncated)
+	}
+
+	return c.apply(before)
 }
 
 func (c *Config) ensureEnvironment() error {
@@ -371,12 +764,38 @@ func (c *Config) deleteConfiguration() {
 	const logPrefix = "forwarding-config-set delete:"
 	c.resolvWatcher.stop()
 	c.hostsWatcher.stop()
+	c.removeStaticHosts()
+	c.logTail.stop()
+	c.logTail = nil
+	c.updateDNSSECStats(nil)
+	c.updateCacheWarmer(nil)
+	c.updateQueryLogger(nil)
+	c.updateTopTalkers(nil)
+	c.blocklistConfig.Set(nil)
 	c.dhcpConfig.Set(nil)
+	c.dhcpv6Config.Set(nil)
+	c.slaacConfig.Set(nil)
 	c.systemConfig.Set(false)
+	c.health.stop()
+	c.health.reset()
+	c.healthReload.stop()
+	c.serversFile.remove()
 	err := c.forwardingProcess.Stop()
 	if err != nil {
 		log.Dlog.Println(logPrefix, err)
 	}
+	err = c.tlsProxyConfig.Set(nil)
+	if err != nil {
+		log.Dlog.Println(logPrefix, err)
+	}
+	err = c.relayConfig.Set(nil)
+	if err != nil {
+		log.Dlog.Println(logPrefix, err)
+	}
+	err = c.aclConfig.Set(nil, nil)
+	if err != nil {
+		log.Dlog.Println(logPrefix, err)
+	}
 
 	files := []string{c.conffile, c.envfile, c.statefile}
 	for _, file := range files {
@@ -407,6 +826,15 @@ func (c *Config) writeForwardingConfig(w io.Writer, conf *ConfigData) error {
 		Conf                *ConfigData
 		UseForwardingConf   bool
 		HostsFile           string
+		StaticHostsFile     string
+		TrustAnchorsFile    string
+		LogQueries          bool
+		QueryLogExtra       bool
+		Upstreams           []upstream
+		TLSNameservers      []NameserverParameters
+		TLSProxyAddress     string
+		RelayAddress        string
+		ServersFile         string
 	}{
 		ConfDir:             c.confdir,
 		ConfDirExt:          strings.Join(c.confdirext, ","),
@@ -415,10 +843,30 @@ func (c *Config) writeForwardingConfig(w io.Writer, conf *ConfigData) error {
 		Conf:                conf,
 		UseForwardingConf:   conf.nsDerivedFromConf(),
 		HostsFile:           c.hostsfile,
-	}
+		StaticHostsFile:     c.statichostsfile,
+		TrustAnchorsFile:    c.trustanchorsfile,
+		LogQueries:          conf.logQueries(),
+		QueryLogExtra:       conf.queryLogExtra(),
+		TLSNameservers:      conf.tlsNameservers(),
+		TLSProxyAddress:     tlsProxyAddress + "#" + strconv.Itoa(tlsProxyPort),
+		RelayAddress:        relayAddress,
+	}
+	// The name servers are checked on their own when the servers
+	// file isn't written.
+	if conf.HealthCheck != nil && c.serversfile != "" {
+		templateInput.ServersFile = c.serversfile
+	}
+	templateInput.Upstreams = conf.upstreams(c.instance,
+		templateInput.ServersFile != "")
 	return cfgFileTemplate.Execute(w, &templateInput)
 }
 
+// vrfDevice returns the name of the network device of a routing
+// instance.
+func vrfDevice(instance string) string {
+	return "vrf" + instance
+}
+
 func writeEnvironmentFile(w io.Writer, pidfile, conffile string) error {
 	tmplInput := struct {
 		PidFile, ConfFile string
@@ -429,14 +877,31 @@ func writeEnvironmentFile(w io.Writer, pidfile, conffile string) error {
 	return envFileTemplate.Execute(w, &tmplInput)
 }
 
+func (c *Config) readLogLine(line string) {
+	if stats := c.getDNSSECStats(); stats != nil {
+		stats.readLine(line)
+	}
+	c.blocklistConfig.getStats().readLine(line)
+	c.getCacheWarmer().readLine(line)
+	c.readQueryLine(line)
+	c.getCacheDump().readLine(line)
+	c.getStateDump().readLine(line)
+}
+
+func (c *Config) logTruncated() {
+	c.getCacheDump().truncated()
+}
+
 type reloadWatcher struct {
 	proc    process.Process
 	file    string
 	watcher *fswatcher.Watcher
 }
 
+// startReloadWatcher reloads dnsmasq whenever file is written, the
+// events are logged with logPrefix.
 func startReloadWatcher(
-	file string,
+	logPrefix, file string,
 	proc process.Process,
 ) *reloadWatcher {
 	out := &reloadWatcher{
@@ -445,7 +910,7 @@ func startReloadWatcher(
 	}
 
 	out.watcher = fswatcher.Start(
-		fswatcher.LogPrefix("resolv watcher:"),
+		fswatcher.LogPrefix(logPrefix),
 		fswatcher.Logger(log.Dlog),
 		fswatcher.Handler(file, out),
 	)
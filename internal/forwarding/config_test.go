@@ -4,9 +4,11 @@ package forwarding
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -22,13 +24,10 @@ func TestWriteForwardingConfig(t *testing.T) {
 		CacheSize:        150,
 		ListenInterfaces: []string{"eth0", "eth1"},
 		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
-		DomainOverrides: []struct {
-			Domain string `rfc7951:"tagnode"`
-			Server string `rfc7951:"server"`
-		}{
+		DomainOverrides: []DomainOverride{
 			{
-				Domain: "jx756k.att.com",
-				Server: "10.156.55.193",
+				Domain:  "jx756k.att.com",
+				Servers: []string{"10.156.55.193"},
 			},
 		},
 	}
@@ -91,6 +90,227 @@ conf-dir=/etc/dnsmasq.d,*.conf
 	}
 }
 
+func TestWriteForwardingConfigDNSSEC(t *testing.T) {
+	tests := []struct {
+		name     string
+		dnssec   *DNSSECConfigData
+		expected string
+	}{
+		{
+			name:   "default-anchors",
+			dnssec: &DNSSECConfigData{Validate: true},
+			expected: `dnssec
+conf-file=/usr/share/dnsmasq-base/trust-anchors.conf
+dnssec-check-unsigned
+`,
+		},
+		{
+			name: "configured-anchors",
+			dnssec: &DNSSECConfigData{
+				Validate: true,
+				TrustAnchors: []string{
+					".,20326,8,2,E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+				},
+				CheckUnsigned: "disabled",
+				Statistics:    true,
+			},
+			expected: `dnssec
+trust-anchor=.,20326,8,2,E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+dnssec-check-unsigned=no
+log-queries
+`,
+		},
+		{
+			name:     "not-validating",
+			dnssec:   &DNSSECConfigData{CheckUnsigned: "disabled"},
+			expected: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &ConfigData{
+				CacheSize:        150,
+				ListenInterfaces: []string{"eth0"},
+				DNSSEC:           test.dnssec,
+			}
+			var buf bytes.Buffer
+			err := NewConfig().writeForwardingConfig(&buf, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+` + test.expected + `no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+			if buf.String() != expected {
+				t.Log("got", buf.String())
+				t.Log("expected", expected)
+				t.Fatal("didn't get expected output")
+			}
+		})
+	}
+}
+
+func TestConfigDataLogQueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     ConfigData
+		expected bool
+	}{
+		{"none", ConfigData{CacheSize: 150}, false},
+		{"dnssec", ConfigData{
+			DNSSEC: &DNSSECConfigData{Validate: true},
+		}, false},
+		{"dnssec-statistics", ConfigData{
+			DNSSEC: &DNSSECConfigData{Validate: true, Statistics: true},
+		}, true},
+		{"blocklist", ConfigData{
+			Blocklists: []Blocklist{{Name: "ads"}},
+		}, false},
+		{"blocklist-hits", ConfigData{
+			Blocklists: []Blocklist{{Name: "ads"}, {Name: "malware", CountHits: true}},
+		}, true},
+		{"cache-persist", ConfigData{
+			CacheSize: 150,
+			Cache:     &CacheConfigData{Persist: true},
+		}, true},
+		{"cache-inspect", ConfigData{
+			CacheSize: 150,
+			Cache:     &CacheConfigData{Inspect: true},
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.conf.logQueries(); got != test.expected {
+				t.Fatalf("got %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestWriteForwardingConfigDomainOverrides(t *testing.T) {
+	config := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		DomainOverrides: []DomainOverride{
+			{
+				Domain:  "att.com",
+				Servers: []string{"10.156.55.193", "2001:db8::53"},
+			},
+			{
+				Domain:  "lab.att.com",
+				Servers: []string{"2001:db8::5353", "10.156.55.194"},
+				Port:    5353,
+			},
+		},
+	}
+	var buf bytes.Buffer
+	err := NewConfig().writeForwardingConfig(&buf, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+server=/att.com/10.156.55.193	# domain-override
+server=/att.com/2001:db8::53	# domain-override
+server=/lab.att.com/2001:db8::5353#5353	# domain-override
+server=/lab.att.com/10.156.55.194#5353	# domain-override
+no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestWriteForwardingConfigDomainOverrideSource(t *testing.T) {
+	config := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		DomainOverrides: []DomainOverride{
+			{
+				Domain:          "corp.att.com",
+				Servers:         []string{"10.156.55.193"},
+				Port:            5353,
+				SourceInterface: "vtun0",
+			},
+			{
+				Domain:        "lab.att.com",
+				Servers:       []string{"2001:db8::53"},
+				SourceAddress: "2001:db8::1",
+			},
+			{
+				Domain:          "eng.att.com",
+				Servers:         []string{"10.156.55.194"},
+				SourceInterface: "vtun1",
+				SourceAddress:   "10.0.0.1",
+			},
+			{
+				Domain:    "home.arpa",
+				LocalOnly: true,
+			},
+		},
+	}
+	var buf bytes.Buffer
+	err := NewConfig().writeForwardingConfig(&buf, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+server=/corp.att.com/10.156.55.193#5353@vtun0	# domain-override
+server=/lab.att.com/2001:db8::53@2001:db8::1	# domain-override
+server=/eng.att.com/10.156.55.194@vtun1@10.0.0.1	# domain-override
+server=/home.arpa/	# domain-override local-only
+no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+
+	ns := readDnsmasqNs(strings.NewReader(buf.String()))
+	expectedNs := []dnsMasqNs{
+		{Server: "10.156.55.193", Port: 5353, Domain: "corp.att.com",
+			Provenance: "configuration"},
+		{Server: "2001:db8::53", Port: 53, Domain: "lab.att.com",
+			Provenance: "configuration"},
+		{Server: "10.156.55.194", Port: 53, Domain: "eng.att.com",
+			Provenance: "configuration"},
+	}
+	if !reflect.DeepEqual(ns, expectedNs) {
+		t.Log("got", ns)
+		t.Log("expected", expectedNs)
+		t.Fatal("didn't get expected name servers")
+	}
+}
+
 func TestWriteEnvironmentFile(t *testing.T) {
 	var buf bytes.Buffer
 	err := writeEnvironmentFile(&buf, "foo.pid", "foo.conf")
@@ -140,8 +360,8 @@ func (p *tproc) Restart() error {
 func (p *tproc) Reload() error {
 	return nil
 }
-func (p *tproc) Signal(signal syscall.Signal) error {
-	const sample = `
+
+const tprocStateSample = `
 Jul 23 11:57:35 dnsmasq[28935]: time 1532372255
 Jul 23 11:57:35 dnsmasq[28935]: cache size 150, 83961/1213146 cache insertions re-used unexpired cache entries.
 Jul 23 11:57:35 dnsmasq[28935]: queries forwarded 363690, queries answered locally 229001
@@ -150,10 +370,29 @@ Jul 23 11:57:35 dnsmasq[28935]: server 10.156.55.193#53: queries sent 0, retried
 Jul 23 11:57:35 dnsmasq[28935]: server 8.8.8.8#53: queries sent 293857, retried or failed 606
 Jul 23 11:57:35 dnsmasq[28935]: server 8.8.4.4#53: queries sent 114783, retried or failed 861
 `
-	ioutil.WriteFile(p.logFile, []byte(sample), 0644)
+
+func (p *tproc) Signal(signal syscall.Signal) error {
+	ioutil.WriteFile(p.logFile, []byte(tprocStateSample), 0644)
 	return nil
 }
 
+// loggingTproc logs its statistics like dnsmasq does when the log is
+// followed, the log is appended to.
+type loggingTproc struct {
+	*tproc
+}
+
+func (p *loggingTproc) Signal(signal syscall.Signal) error {
+	f, err := os.OpenFile(p.logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE,
+		0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(tprocStateSample)
+	return err
+}
+
 func newTestConfig(opts ...ConfigOption) *Config {
 	dopts := []ConfigOption{
 		Unit("dnsmasq.service"),
@@ -169,7 +408,12 @@ func newTestConfig(opts ...ConfigOption) *Config {
 
 		ResolvFile("tmp/resolv.conf"),
 		HostsFile("tmp/hosts"),
+		StaticHostsFile("tmp/static-hosts"),
 		DHCPWatchFmt("tmp/dhclient_%s_lease"),
+		DHCPv6ConfigFileFmt("tmp/dhcpv6interface-%s.conf"),
+		DHCPv6WatchFmt("tmp/dhclient_v6_%s_lease"),
+		ServersFile("tmp/servers.conf"),
+		CacheSnapshotFile("tmp/cache-snapshot"),
 	}
 	dopts = append(dopts, opts...)
 	return NewConfig(dopts...)
@@ -199,13 +443,10 @@ func TestConfigObjectSet(t *testing.T) {
 		CacheSize:        150,
 		ListenInterfaces: []string{"eth0", "eth1"},
 		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
-		DomainOverrides: []struct {
-			Domain string `rfc7951:"tagnode"`
-			Server string `rfc7951:"server"`
-		}{
+		DomainOverrides: []DomainOverride{
 			{
-				Domain: "jx756k.att.com",
-				Server: "10.156.55.193",
+				Domain:  "jx756k.att.com",
+				Servers: []string{"10.156.55.193"},
 			},
 		},
 	}
@@ -312,13 +553,10 @@ func TestConfigObjectGet(t *testing.T) {
 		CacheSize:        150,
 		ListenInterfaces: []string{"eth0", "eth1"},
 		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
-		DomainOverrides: []struct {
-			Domain string `rfc7951:"tagnode"`
-			Server string `rfc7951:"server"`
-		}{
+		DomainOverrides: []DomainOverride{
 			{
-				Domain: "jx756k.att.com",
-				Server: "10.156.55.193",
+				Domain:  "jx756k.att.com",
+				Servers: []string{"10.156.55.193"},
 			},
 		},
 	}
@@ -364,13 +602,10 @@ func TestStateObjectGet(t *testing.T) {
 		CacheSize:        150,
 		ListenInterfaces: []string{"eth0", "eth1"},
 		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
-		DomainOverrides: []struct {
-			Domain string `rfc7951:"tagnode"`
-			Server string `rfc7951:"server"`
-		}{
+		DomainOverrides: []DomainOverride{
 			{
-				Domain: "jx756k.att.com",
-				Server: "10.156.55.193",
+				Domain:  "jx756k.att.com",
+				Servers: []string{"10.156.55.193"},
 			},
 		},
 	}
@@ -395,6 +630,7 @@ func TestStateObjectGet(t *testing.T) {
 	expected := &StateData{}
 	expected.State.QueriesForwarded = 363690
 	expected.State.QueriesAnswered = 229001
+	expected.State.ForwardingPolicy = "fastest"
 	expected.State.Cache.Size = 150
 	expected.State.Cache.Entries = 1213146
 	expected.State.Cache.ReusedEntries = 83961
@@ -435,6 +671,67 @@ func TestStateObjectGet(t *testing.T) {
 	}
 }
 
+func TestStateObjectGetFollowedLog(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	const earlier = "Jul 23 11:57:30 dnsmasq[28935]: query[A] example.com from 192.0.2.10\n"
+	err = ioutil.WriteFile("tmp/dnsmasq.log", []byte(earlier), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := &loggingTproc{newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log")}
+	conf := newTestConfig(processConstructor(
+		func(string) process.Process {
+			return proc
+		}))
+	data := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
+		// Inspecting the cache has the log followed.
+		Cache: &CacheConfigData{Inspect: true},
+	}
+	err = conf.Set(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case act := <-proc.actions:
+		if act != "Restart" {
+			t.Fatalf("Restart expected, got %s", act)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timeout waiting for Restart signal")
+	}
+
+	sdata := NewState(conf).Get()
+	if sdata.State.QueriesForwarded != 363690 ||
+		sdata.State.Cache.Size != 150 ||
+		len(sdata.State.Nameservers) != 3 {
+		t.Fatal("didn't get expected state", sdata)
+	}
+
+	// The lines not read yet by the other consumers are still there.
+	buf, err := ioutil.ReadFile("tmp/dnsmasq.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buf), earlier) {
+		t.Fatal("log truncated", string(buf))
+	}
+
+	err = conf.Set(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+}
+
 func TestConfigObjectSetWithSystemNameservers(t *testing.T) {
 	err := os.MkdirAll("tmp", 0755)
 	if err != nil {
@@ -453,13 +750,10 @@ func TestConfigObjectSetWithSystemNameservers(t *testing.T) {
 		ListenInterfaces: []string{"eth0", "eth1"},
 		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
 		System:           true,
-		DomainOverrides: []struct {
-			Domain string `rfc7951:"tagnode"`
-			Server string `rfc7951:"server"`
-		}{
+		DomainOverrides: []DomainOverride{
 			{
-				Domain: "jx756k.att.com",
-				Server: "10.156.55.193",
+				Domain:  "jx756k.att.com",
+				Servers: []string{"10.156.55.193"},
 			},
 		},
 	}
@@ -519,13 +813,10 @@ func TestConfigObjectSetWithDHCPNameservers(t *testing.T) {
 		DHCPInterfaces:   []string{"eth0"},
 		ListenInterfaces: []string{"eth1"},
 		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
-		DomainOverrides: []struct {
-			Domain string `rfc7951:"tagnode"`
-			Server string `rfc7951:"server"`
-		}{
+		DomainOverrides: []DomainOverride{
 			{
-				Domain: "jx756k.att.com",
-				Server: "10.156.55.193",
+				Domain:  "jx756k.att.com",
+				Servers: []string{"10.156.55.193"},
 			},
 		},
 	}
@@ -567,3 +858,345 @@ new_domain_name_servers=2.2.2.2
 		t.Fatal(err)
 	}
 }
+
+type tnotifier struct {
+	updates chan []ActiveNameserver
+}
+
+func (n *tnotifier) NameserversUpdated(
+	instance string,
+	nameservers []ActiveNameserver,
+) {
+	n.updates <- nameservers
+}
+
+func (n *tnotifier) NameserverStatusChanged(
+	instance string,
+	status NameserverHealth,
+) {
+}
+
+func TestConfigObjectSetNotifiesNameservers(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log")
+	notifier := &tnotifier{updates: make(chan []ActiveNameserver, 1)}
+	conf := newTestConfig(
+		processConstructor(
+			func(string) process.Process {
+				return proc
+			}),
+		Notifications(notifier),
+	)
+	data := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0", "eth1"},
+		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
+		DomainOverrides: []DomainOverride{
+			{
+				Domain:  "jx756k.att.com",
+				Servers: []string{"10.156.55.193"},
+			},
+		},
+	}
+
+	err = conf.Set(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+
+	expected := []ActiveNameserver{
+		{Address: "8.8.8.8", Port: 53},
+		{Address: "8.8.4.4", Port: 53},
+	}
+	select {
+	case got := <-notifier.updates:
+		if !reflect.DeepEqual(got, expected) {
+			t.Log("got", got)
+			t.Log("expected", expected)
+			t.Fatal("didn't get expected name servers")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timeout waiting for notification")
+	}
+
+	// Changing the cache size doesn't change the active name servers
+	resized := *data
+	resized.CacheSize = 200
+	err = conf.Set(&resized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+	select {
+	case got := <-notifier.updates:
+		t.Fatal("unexpected notification", got)
+	default:
+	}
+
+	err = conf.Set(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+	select {
+	case got := <-notifier.updates:
+		if len(got) != 0 {
+			t.Fatal("expected no active name servers, got", got)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timeout waiting for notification")
+	}
+}
+
+// testLearnedNameservers has the name servers of data learned from
+// file, and checks that every change of them is notified exactly once
+// and that rewriting file with the same content isn't notified.
+func testLearnedNameservers(
+	t *testing.T,
+	data *ConfigData,
+	file, learned, relearned string,
+	expected, reexpected []ActiveNameserver,
+) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log")
+	notifier := &tnotifier{updates: make(chan []ActiveNameserver, 1)}
+	conf := newTestConfig(
+		processConstructor(
+			func(string) process.Process {
+				return proc
+			}),
+		Notifications(notifier),
+		// dnsmasq only uses the fragments in its conf-dir.
+		DHCPConfigFileFmt("tmp/dnsmasq.d/dhcpinterface-%s.conf"),
+		SystemConfigFile("tmp/dnsmasq.d/system.conf"),
+	)
+
+	err = conf.Set(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+
+	expectNotification := func(expected []ActiveNameserver) {
+		select {
+		case act := <-proc.actions:
+			if act != "Restart" {
+				t.Fatalf("Restart expected, got %s", act)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("timeout waiting for Restart")
+		}
+		select {
+		case got := <-notifier.updates:
+			if !reflect.DeepEqual(got, expected) {
+				t.Log("got", got)
+				t.Log("expected", expected)
+				t.Fatal("didn't get expected name servers")
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("timeout waiting for notification")
+		}
+		select {
+		case act := <-proc.actions:
+			t.Fatal("unexpected action", act)
+		case got := <-notifier.updates:
+			t.Fatal("unexpected notification", got)
+		default:
+		}
+	}
+
+	err = ioutil.WriteFile(file, []byte(learned), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNotification(expected)
+
+	// Rewriting the same name servers neither restarts dnsmasq nor
+	// notifies.
+	err = ioutil.WriteFile(file, []byte(learned), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case act := <-proc.actions:
+		t.Fatal("no action expected, got", act)
+	case got := <-notifier.updates:
+		t.Fatal("unexpected notification", got)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	err = ioutil.WriteFile(file, []byte(relearned), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNotification(reexpected)
+
+	err = conf.Set(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+	<-notifier.updates
+}
+
+func TestDHCPNameserversNotified(t *testing.T) {
+	data := &ConfigData{
+		CacheSize:        150,
+		DHCPInterfaces:   []string{"eth0"},
+		ListenInterfaces: []string{"eth1"},
+	}
+	const lease = `
+new_domain_name_servers=1.1.1.1
+`
+	const renewed = `
+new_domain_name_servers=1.1.1.1
+new_domain_name_servers=2.2.2.2
+`
+	testLearnedNameservers(t, data, "tmp/dhclient_eth0_lease",
+		lease, renewed,
+		[]ActiveNameserver{{Address: "1.1.1.1", Port: 53}},
+		[]ActiveNameserver{
+			{Address: "1.1.1.1", Port: 53},
+			{Address: "2.2.2.2", Port: 53},
+		})
+}
+
+func TestSystemNameserversNotified(t *testing.T) {
+	data := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth1"},
+		System:           true,
+	}
+	const resolv = `
+nameserver 1.1.1.1 # system added by vyatta-system-nameservers
+`
+	const changed = `
+nameserver 2.2.2.2 # system added by vyatta-system-nameservers
+`
+	testLearnedNameservers(t, data, "tmp/resolv.conf",
+		resolv, changed,
+		[]ActiveNameserver{{Address: "1.1.1.1", Port: 53}},
+		[]ActiveNameserver{{Address: "2.2.2.2", Port: 53}})
+}
+
+// failingTproc records the configuration of every restart.
+type failingTproc struct {
+	*tproc
+	fail     bool
+	restarts []string
+}
+
+func (p *failingTproc) Restart() error {
+	buf, err := ioutil.ReadFile(p.confFile)
+	p.restarts = append(p.restarts, string(buf))
+	if p.fail {
+		return errors.New("restart failed")
+	}
+	return err
+}
+
+func TestConfigObjectSetFailureRestoresFiles(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := &failingTproc{
+		tproc: newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log"),
+	}
+	conf := newTestConfig(processConstructor(
+		func(string) process.Process {
+			return proc
+		}))
+	err = conf.Set(&ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc.fail = true
+	err = conf.Set(&ConfigData{
+		CacheSize:        300,
+		ListenInterfaces: []string{"eth0"},
+	})
+	if err == nil {
+		t.Fatal("expected restart failure")
+	}
+	if len(proc.restarts) != 3 ||
+		!strings.Contains(proc.restarts[1], "cache-size=300") ||
+		!strings.Contains(proc.restarts[2], "cache-size=150") {
+		t.Fatal("dnsmasq not restarted on the previous files:",
+			proc.restarts)
+	}
+	buf, err := ioutil.ReadFile("tmp/dnsmasq.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), "cache-size=150") {
+		t.Fatal("previous configuration file not restored:", string(buf))
+	}
+}
+
+func TestConfigObjectSetFailureAllowsRollback(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := &failingTproc{
+		tproc: newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log"),
+	}
+	conf := newTestConfig(processConstructor(
+		func(string) process.Process {
+			return proc
+		}))
+	old := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+	}
+	err = conf.Set(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc.fail = true
+	err = conf.Set(&ConfigData{
+		CacheSize:        300,
+		ListenInterfaces: []string{"eth0"},
+	})
+	if err == nil {
+		t.Fatal("expected restart failure")
+	}
+
+	// Restoring the previous configuration must not be skipped,
+	// dnsmasq failed to restart on the restored files too.
+	proc.fail = false
+	proc.restarts = nil
+	err = conf.Set(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proc.restarts) != 1 ||
+		!strings.Contains(proc.restarts[0], "cache-size=150") {
+		t.Fatal("previous configuration was not restored:", proc.restarts)
+	}
+}
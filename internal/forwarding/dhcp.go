@@ -3,8 +3,10 @@
 package forwarding
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"regexp"
 	"strings"
@@ -32,12 +34,18 @@ func init() {
 	dhcpFileTemplate = template.Must(t.Parse(dhcpFile))
 }
 
+// dhcpRenderer writes the dnsmasq fragment for intf from the lease
+// information dhclient left for it.
+type dhcpRenderer func(w io.Writer, intf string, lease io.Reader) error
+
 type dhcpConfig struct {
 	interfaces  []string
 	proc        process.Process
 	watcher     *dhcpWatcher
 	watchFmt    string
 	confFileFmt string
+	render      dhcpRenderer
+	notify      func()
 }
 
 func (c *dhcpConfig) removeConfFiles() {
@@ -57,7 +65,8 @@ func (c *dhcpConfig) Set(new []string) error {
 	} else {
 		c.watcher.stop()
 		c.removeConfFiles()
-		c.watcher = startDhcpWatcher(new, c.proc, c.watchFmt, c.confFileFmt)
+		c.watcher = startDhcpWatcher(new, c.proc, c.watchFmt,
+			c.confFileFmt, c.render, c.notify)
 	}
 	c.interfaces = new
 	return nil
@@ -71,17 +80,23 @@ type dhcpWatcher struct {
 	watcher     *fswatcher.Watcher
 	fileToIntf  map[string]string
 	confFileFmt string
+	render      dhcpRenderer
+	notify      func()
 }
 
 func startDhcpWatcher(
 	interfaces []string,
 	proc process.Process,
 	watchPattern, confFileFmt string,
+	render dhcpRenderer,
+	notify func(),
 ) *dhcpWatcher {
 	out := &dhcpWatcher{
 		proc:        proc,
 		fileToIntf:  make(map[string]string),
 		confFileFmt: confFileFmt,
+		render:      render,
+		notify:      notify,
 	}
 	opts := make([]fswatcher.WatcherOpt, 0, len(interfaces)+2)
 	opts = append(opts,
@@ -97,7 +112,7 @@ func startDhcpWatcher(
 	}
 	for file := range out.fileToIntf {
 		if _, err := os.Stat(file); err == nil {
-			err := out.writeConffileFromDhclient(file)
+			_, err := out.writeConffileFromDhclient(file)
 			if err != nil {
 				log.Dlog.Println("dhcp nameserver watcher:", err)
 			}
@@ -107,34 +122,53 @@ func startDhcpWatcher(
 	return out
 }
 
-func (w *dhcpWatcher) writeConffileFromDhclient(dhclientFile string) error {
+// writeConffileFromDhclient renders the fragment for dhclientFile and
+// reports whether it differs from the one dnsmasq is using.
+func (w *dhcpWatcher) writeConffileFromDhclient(dhclientFile string) (bool, error) {
 	f, err := os.Open(dhclientFile)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer f.Close()
 
 	intf := w.fileToIntf[dhclientFile]
-	out, err := os.OpenFile(fmt.Sprintf(w.confFileFmt, intf), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	var buf bytes.Buffer
+	err = w.render(&buf, intf, f)
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer out.Close()
+	return writeFileIfChanged(fmt.Sprintf(w.confFileFmt, intf), buf.Bytes())
+}
 
-	err = writeDnsmasqDhcpConfig(out, intf, readDhcpNameservers(f))
+// writeFileIfChanged replaces the content of file with data and
+// reports whether that changed anything.
+func writeFileIfChanged(file string, data []byte) (bool, error) {
+	cur, err := ioutil.ReadFile(file)
+	if err == nil && bytes.Equal(cur, data) {
+		return false, nil
+	}
+	err = ioutil.WriteFile(file, data, 0644)
 	if err != nil {
-		return err
+		return false, err
 	}
-
-	return nil
+	return true, nil
 }
 
 func (w *dhcpWatcher) createOrWrite(name string) error {
-	err := w.writeConffileFromDhclient(name)
+	changed, err := w.writeConffileFromDhclient(name)
+	if err != nil || !changed {
+		// Renewals usually hand out the same name servers, dnsmasq
+		// is only restarted when they change.
+		return err
+	}
+	err = w.proc.Restart()
 	if err != nil {
 		return err
 	}
-	return w.proc.Restart()
+	if w.notify != nil {
+		w.notify()
+	}
+	return nil
 }
 
 func (w *dhcpWatcher) CloseWrite(name string) error {
@@ -166,6 +200,10 @@ func writeDnsmasqDhcpConfig(w io.Writer, intf string, ns []string) error {
 	return dhcpFileTemplate.Execute(w, &conf)
 }
 
+func renderDhcpConfig(w io.Writer, intf string, lease io.Reader) error {
+	return writeDnsmasqDhcpConfig(w, intf, readDhcpNameservers(lease))
+}
+
 func readDhcpNameservers(r io.Reader) []string {
 	var ns []string
 	err := byline.NewReader(r).
@@ -0,0 +1,114 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/danos/vyatta-service-dns/internal/log"
+	"github.com/msoap/byline"
+)
+
+// IPv6 name servers are learned together with a domain search list,
+// from DHCPv6 or from router advertisements. Queries for the search
+// list are sent to the name servers learned with it, as the list names
+// the domains those servers know best.
+const ipv6NameserverFile = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost.
+{{range .Nameservers -}}
+server={{scoped . $.Interface}}	# {{$.Source}} {{$.Interface}}
+{{end -}}
+{{range $domain := .Domains -}}
+{{range $.Nameservers -}}
+server=/{{$domain}}/{{scoped . $.Interface}}	# {{$.Source}} {{$.Interface}}
+{{end -}}
+{{end -}}
+`
+
+var ipv6NameserverFileTemplate *template.Template
+
+func init() {
+	t := template.New("IPv6NameserverConf")
+	t.Funcs(template.FuncMap{
+		"scoped": scopedServerAddress,
+	})
+	ipv6NameserverFileTemplate = template.Must(t.Parse(ipv6NameserverFile))
+}
+
+// scopedServerAddress qualifies link-local name servers with the
+// interface they were learned on, dnsmasq can't reach them otherwise.
+func scopedServerAddress(addr, intf string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil || !ip.IsLinkLocalUnicast() {
+		return addr
+	}
+	return addr + "%" + intf
+}
+
+type dhcpv6Lease struct {
+	Nameservers []string
+	Domains     []string
+}
+
+func readDhcpv6Lease(r io.Reader) dhcpv6Lease {
+	var lease dhcpv6Lease
+	err := byline.NewReader(r).
+		GrepByRegexp(regexp.MustCompile(
+			"^new_dhcp6_(name_servers|domain_search)=")).
+		SetFS(regexp.MustCompile("[= ]")).
+		AWKMode(func(line string, fields []string, vars byline.AWKVars) (string, error) {
+			for _, field := range fields[1:] {
+				value := strings.Trim(strings.TrimSpace(field), "'")
+				if value == "" {
+					continue
+				}
+				switch fields[0] {
+				case "new_dhcp6_name_servers":
+					lease.Nameservers = append(lease.Nameservers, value)
+				case "new_dhcp6_domain_search":
+					lease.Domains = append(lease.Domains,
+						strings.TrimSuffix(value, "."))
+				}
+			}
+			return "", nil
+		}).
+		Discard()
+	if err != nil {
+		log.Wlog.Println(err)
+	}
+	return lease
+}
+
+func writeDnsmasqIPv6Config(
+	w io.Writer,
+	source, intf string,
+	lease dhcpv6Lease,
+) error {
+	conf := struct {
+		Source      string
+		Interface   string
+		Nameservers []string
+		Domains     []string
+	}{
+		Source:      source,
+		Interface:   intf,
+		Nameservers: lease.Nameservers,
+		Domains:     lease.Domains,
+	}
+	if len(lease.Nameservers) == 0 {
+		return nil
+	}
+	return ipv6NameserverFileTemplate.Execute(w, &conf)
+}
+
+func writeDnsmasqDhcpv6Config(w io.Writer, intf string, lease dhcpv6Lease) error {
+	return writeDnsmasqIPv6Config(w, "dhcpv6", intf, lease)
+}
+
+func renderDhcpv6Config(w io.Writer, intf string, lease io.Reader) error {
+	return writeDnsmasqDhcpv6Config(w, intf, readDhcpv6Lease(lease))
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/process"
+)
+
+func TestReadDhcpv6Lease(t *testing.T) {
+	const input = `
+Wed Jul 25 10:22:27 UTC 2018
+reason='REBIND6'
+interface='dp0s3'
+new_ip6_address='2001:db8:1::100'
+new_ip6_prefixlen='128'
+new_dhcp6_name_servers='2001:db8:1::53 fe80::1'
+new_dhcp6_domain_search='lab.att.com. att.com.'
+new_dhcp6_server_id='0:1:0:1:22:8f:27:f1:52:54:0:12:34:56'
+old_dhcp6_name_servers='2001:db8:1::54'
+old_dhcp6_domain_search='old.att.com.'
+`
+	expected := dhcpv6Lease{
+		Nameservers: []string{"2001:db8:1::53", "fe80::1"},
+		Domains:     []string{"lab.att.com", "att.com"},
+	}
+	lease := readDhcpv6Lease(strings.NewReader(input))
+	if !reflect.DeepEqual(lease, expected) {
+		t.Log("got", lease)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected lease")
+	}
+}
+
+func TestWriteDnsmasqDhcpv6Config(t *testing.T) {
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost.
+server=2001:db8:1::53	# dhcpv6 eth0
+server=fe80::1%eth0	# dhcpv6 eth0
+server=/lab.att.com/2001:db8:1::53	# dhcpv6 eth0
+server=/lab.att.com/fe80::1%eth0	# dhcpv6 eth0
+`
+	var buf bytes.Buffer
+	err := writeDnsmasqDhcpv6Config(&buf, "eth0", dhcpv6Lease{
+		Nameservers: []string{"2001:db8:1::53", "fe80::1"},
+		Domains:     []string{"lab.att.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestWriteDnsmasqDhcpv6ConfigNoNameservers(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeDnsmasqDhcpv6Config(&buf, "eth0", dhcpv6Lease{
+		Domains: []string{"lab.att.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("unexpected output", buf.String())
+	}
+}
+
+func TestReadDnsmasqNsDhcpv6Provenance(t *testing.T) {
+	const conf = `
+server=2001:db8:1::53	# dhcpv6 eth0
+server=/lab.att.com/2001:db8:1::53	# dhcpv6 eth0
+server=/att.com/10.0.0.53	# domain-override
+`
+	expected := []dnsMasqNs{
+		{
+			Server:     "2001:db8:1::53",
+			Port:       53,
+			Provenance: "dhcpv6",
+		},
+		{
+			Server:     "2001:db8:1::53",
+			Port:       53,
+			Domain:     "lab.att.com",
+			Provenance: "dhcpv6",
+		},
+		{
+			Server:     "10.0.0.53",
+			Port:       53,
+			Domain:     "att.com",
+			Provenance: "configuration",
+		},
+	}
+	ns := readDnsmasqNs(strings.NewReader(conf))
+	if !reflect.DeepEqual(ns, expected) {
+		t.Log("got", ns)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected name servers")
+	}
+}
+
+func TestConfigObjectSetWithDHCPv6Nameservers(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log")
+	conf := newTestConfig(processConstructor(
+		func(string) process.Process {
+			return proc
+		}))
+	data := &ConfigData{
+		CacheSize:        150,
+		DHCPv6Interfaces: []string{"eth0"},
+		ListenInterfaces: []string{"eth1"},
+	}
+
+	err = conf.Set(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case act := <-proc.actions:
+		if act != "Restart" {
+			t.Fatalf("Restart expected, got %s", act)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timeout waiting for Restart signal 1")
+	}
+
+	const leaseData = `
+new_dhcp6_name_servers='2001:db8:1::53'
+new_dhcp6_domain_search='lab.att.com.'
+`
+	err = ioutil.WriteFile("tmp/dhclient_v6_eth0_lease", []byte(leaseData), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case act := <-proc.actions:
+		if act != "Restart" {
+			t.Fatalf("Restart expected, got %s", act)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timeout waiting for Restart signal 2")
+	}
+	_, err = os.Stat("tmp/dhcpv6interface-eth0.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A renewal with the same name servers leaves dnsmasq alone.
+	err = ioutil.WriteFile("tmp/dhclient_v6_eth0_lease",
+		[]byte("reason='RENEW6'\n"+leaseData), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case act := <-proc.actions:
+		t.Fatalf("no action expected, got %s", act)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
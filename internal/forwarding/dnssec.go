@@ -0,0 +1,65 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"regexp"
+	"sync/atomic"
+)
+
+type DNSSECConfigData struct {
+	Validate      bool     `rfc7951:"validate,emptyleaf"`
+	TrustAnchors  []string `rfc7951:"trust-anchor,omitempty"`
+	CheckUnsigned string   `rfc7951:"check-unsigned,omitempty"`
+	// Statistics has dnsmasq log every query, validation results are
+	// only seen in its log.
+	Statistics bool `rfc7951:"statistics,emptyleaf"`
+}
+
+type DNSSECState struct {
+	Validated uint64 `rfc7951:"validated-answers"`
+	Bogus     uint64 `rfc7951:"bogus-answers"`
+}
+
+// dnsmasq logs the outcome of every validation when log-queries is
+// enabled, older releases log "result" in place of the name.
+var dnssecResultExp = regexp.MustCompile(`validation \S+ is (SECURE|BOGUS)`)
+
+type dnssecStats struct {
+	validated uint64
+	bogus     uint64
+}
+
+func (s *dnssecStats) readLine(line string) {
+	match := dnssecResultExp.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	switch match[1] {
+	case "SECURE":
+		atomic.AddUint64(&s.validated, 1)
+	case "BOGUS":
+		atomic.AddUint64(&s.bogus, 1)
+	}
+}
+
+func (s *dnssecStats) get() *DNSSECState {
+	return &DNSSECState{
+		Validated: atomic.LoadUint64(&s.validated),
+		Bogus:     atomic.LoadUint64(&s.bogus),
+	}
+}
+
+func (c *Config) getDNSSECStats() *dnssecStats {
+	return c.dnssec.Load().(*dnssecStats)
+}
+
+func (c *Config) updateDNSSECStats(conf *ConfigData) {
+	if conf == nil || !conf.dnssecStatistics() {
+		c.dnssec.Store((*dnssecStats)(nil))
+		return
+	}
+	if c.getDNSSECStats() == nil {
+		c.dnssec.Store(&dnssecStats{})
+	}
+}
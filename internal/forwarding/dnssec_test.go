@@ -0,0 +1,76 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSSECStatsReadLine(t *testing.T) {
+	const sample = `Oct 16 10:00:01 dnsmasq[812]: query[A] example.com from 192.0.2.10
+Oct 16 10:00:01 dnsmasq[812]: validation example.com is SECURE
+Oct 16 10:00:02 dnsmasq[812]: validation dnssec-failed.org is BOGUS
+Oct 16 10:00:03 dnsmasq[812]: validation result is SECURE
+Oct 16 10:00:04 dnsmasq[812]: validation insecure.example is INSECURE
+`
+	stats := &dnssecStats{}
+	for _, line := range strings.Split(sample, "\n") {
+		stats.readLine(line)
+	}
+	expected := &DNSSECState{Validated: 2, Bogus: 1}
+	if got := stats.get(); !reflect.DeepEqual(got, expected) {
+		t.Log("got", got)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected value")
+	}
+}
+
+func TestLogTailFollowsTruncation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logtail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "dnsmasq.log")
+	err = ioutil.WriteFile(file, []byte("old line\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string, 10)
+	tail := startLogTail(file, func(line string) { lines <- line }, nil)
+	defer tail.stop()
+
+	expect := func(expected string) {
+		t.Helper()
+		select {
+		case line := <-lines:
+			if line != expected {
+				t.Fatalf("got %q, expected %q", line, expected)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("timed out waiting for", expected)
+		}
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("first ")
+	f.WriteString("line\n")
+	f.Close()
+	expect("first line")
+
+	err = ioutil.WriteFile(file, []byte("after truncate\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect("after truncate")
+}
@@ -0,0 +1,540 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+const (
+	defaultHealthInterval         = 30
+	defaultHealthTimeout          = 2000
+	defaultHealthFailureThreshold = 3
+	// healthReloadHoldDown is the least time between two reloads for
+	// changes in health, every reload empties the cache of dnsmasq.
+	healthReloadHoldDown = 30 * time.Second
+)
+
+// While health checking is enabled the statically configured name
+// servers are listed in a servers file, dnsmasq re-reads it when it is
+// reloaded. Name servers that are down are left out as long as any
+// of them is up. Learned name servers, those reached over TLS and
+// those in other routing instances are probed and reported only.
+const serversFile = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost.
+{{range . -}}
+server={{.}}	# statically configured
+{{end -}}
+`
+
+var serversFileTemplate *template.Template
+
+func init() {
+	t := template.New("ServersConf")
+	t.Funcs(template.FuncMap{})
+	serversFileTemplate = template.Must(t.Parse(serversFile))
+}
+
+type HealthCheck struct {
+	// Interval between probes in seconds.
+	Interval uint32 `rfc7951:"interval,omitempty"`
+	// Timeout of a probe in milliseconds.
+	Timeout          uint32 `rfc7951:"timeout,omitempty"`
+	FailureThreshold uint32 `rfc7951:"failure-threshold,omitempty"`
+}
+
+func (h *HealthCheck) interval() time.Duration {
+	if h.Interval == 0 {
+		return defaultHealthInterval * time.Second
+	}
+	return time.Duration(h.Interval) * time.Second
+}
+
+func (h *HealthCheck) timeout() time.Duration {
+	if h.Timeout == 0 {
+		return defaultHealthTimeout * time.Millisecond
+	}
+	return time.Duration(h.Timeout) * time.Millisecond
+}
+
+func (h *HealthCheck) failureThreshold() uint32 {
+	if h.FailureThreshold == 0 {
+		return defaultHealthFailureThreshold
+	}
+	return h.FailureThreshold
+}
+
+// NameserverHealth is the result of probing a name server, it is
+// reported whenever a name server goes up or down.
+type NameserverHealth struct {
+	Address string `rfc7951:"address"`
+	Port    uint16 `rfc7951:"port"`
+	Status  string `rfc7951:"status"`
+}
+
+type healthTarget struct {
+	Address string
+	Port    uint16
+	// Device the probe is sent from, the routing instance the name
+	// server is reached in.
+	Device string
+}
+
+func (t healthTarget) key() string {
+	return nameserverKey(t.Address, t.Port)
+}
+
+type serverHealth struct {
+	target      healthTarget
+	probed      bool
+	up          bool
+	failures    uint32
+	successes   uint32
+	rtt         time.Duration
+	lastSuccess time.Time
+}
+
+func (h *serverHealth) status() string {
+	if h.up {
+		return "up"
+	}
+	return "down"
+}
+
+// probeNameserver sends a query for the root name servers to target,
+// any answer that isn't a server failure shows that it is working.
+func probeNameserver(target healthTarget, timeout time.Duration) (time.Duration, error) {
+	client := &dnsclient.Client{
+		Timeout: timeout,
+		Device:  target.Device,
+	}
+	resp, rtt, err := client.Exchange(
+		dnsclient.NewQuery(".", dnsclient.TypeNS, dnsclient.ClassINET),
+		net.JoinHostPort(target.Address, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		return 0, err
+	}
+	if resp.Rcode != dnsclient.RcodeSuccess &&
+		resp.Rcode != dnsclient.RcodeNameError {
+		return 0, errors.New("probe answered with " +
+			dnsclient.RcodeString(resp.Rcode))
+	}
+	return rtt, nil
+}
+
+// healthChecker probes the name servers of an instance at a regular
+// interval. A name server is down once it failed to answer
+// failure-threshold probes in a row and up again once it answered as
+// many in a row, so that a flapping name server doesn't change state
+// with every probe.
+type healthChecker struct {
+	mu      sync.Mutex
+	params  HealthCheck
+	targets func() []healthTarget
+	changed func([]NameserverHealth)
+	probe   func(healthTarget, time.Duration) (time.Duration, error)
+	now     func() time.Time
+	servers map[string]*serverHealth
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newHealthChecker(changed func([]NameserverHealth)) *healthChecker {
+	return &healthChecker{
+		changed: changed,
+		probe:   probeNameserver,
+		now:     time.Now,
+		servers: make(map[string]*serverHealth),
+	}
+}
+
+func (h *healthChecker) start(params HealthCheck, targets func() []healthTarget) {
+	h.stop()
+	h.mu.Lock()
+	h.params = params
+	h.targets = targets
+	h.done = make(chan struct{})
+	h.mu.Unlock()
+
+	h.wg.Add(1)
+	go h.run(h.done, params.interval())
+}
+
+func (h *healthChecker) stop() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	done := h.done
+	h.done = nil
+	h.mu.Unlock()
+	if done == nil {
+		return
+	}
+	close(done)
+	h.wg.Wait()
+}
+
+// reset forgets everything learned about the name servers.
+func (h *healthChecker) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.servers = make(map[string]*serverHealth)
+}
+
+func (h *healthChecker) run(done chan struct{}, interval time.Duration) {
+	defer h.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.check()
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// check probes every target once and reports the name servers whose
+// status changed.
+func (h *healthChecker) check() {
+	h.mu.Lock()
+	targets := h.targets()
+	params := h.params
+	h.mu.Unlock()
+
+	type result struct {
+		rtt time.Duration
+		err error
+	}
+	results := make([]result, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target healthTarget) {
+			defer wg.Done()
+			rtt, err := h.probe(target, params.timeout())
+			results[i] = result{rtt: rtt, err: err}
+		}(i, target)
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	now := h.now()
+	var changes []NameserverHealth
+	seen := make(map[string]struct{})
+	for i, target := range targets {
+		key := target.key()
+		seen[key] = struct{}{}
+		s, ok := h.servers[key]
+		if !ok {
+			s = &serverHealth{up: true}
+			h.servers[key] = s
+		}
+		s.target = target
+		wasUp, wasProbed := s.up, s.probed
+		s.probed = true
+		if err := results[i].err; err != nil {
+			log.Dlog.Println("forwarding-health:", target.Address, err)
+			s.failures++
+			s.successes = 0
+			if s.failures >= params.failureThreshold() {
+				s.up = false
+			}
+		} else {
+			s.failures = 0
+			s.successes++
+			if s.successes >= params.failureThreshold() {
+				s.up = true
+			}
+			s.rtt = results[i].rtt
+			s.lastSuccess = now
+		}
+		if s.up != wasUp || (!wasProbed && !s.up) {
+			changes = append(changes, NameserverHealth{
+				Address: target.Address,
+				Port:    target.Port,
+				Status:  s.status(),
+			})
+		}
+	}
+	for key := range h.servers {
+		if _, ok := seen[key]; !ok {
+			delete(h.servers, key)
+		}
+	}
+	h.mu.Unlock()
+
+	if len(changes) > 0 && h.changed != nil {
+		h.changed(changes)
+	}
+}
+
+// isDown reports whether the name server addr#port was found to be
+// down, name servers that were never probed are assumed to be up.
+func (h *healthChecker) isDown(addr string, port uint16) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.servers[nameserverKey(addr, port)]
+	return ok && !s.up
+}
+
+func (h *healthChecker) get() []serverHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]serverHealth, 0, len(h.servers))
+	for _, s := range h.servers {
+		if s.probed {
+			out = append(out, *s)
+		}
+	}
+	return out
+}
+
+// healthTargets returns the name servers dnsmasq may forward to. The
+// statically configured name servers come from the configuration as
+// the ones that are down are missing from the servers file. Name
+// servers behind the TLS proxy are covered by the proxy status.
+func (c *Config) healthTargets(conf *ConfigData) []healthTarget {
+	var out []healthTarget
+	seen := make(map[string]struct{})
+	add := func(t healthTarget) {
+		if _, ok := seen[t.key()]; ok {
+			return
+		}
+		seen[t.key()] = struct{}{}
+		out = append(out, t)
+	}
+	device := relayDevice(c.instance)
+	for _, ns := range conf.plainNameservers(c.instance) {
+		add(healthTarget{Address: ns, Port: defaultPort, Device: device})
+	}
+
+	f, err := os.Open(c.conffile)
+	if err != nil {
+		log.Dlog.Println("forwarding-health:", err)
+		return out
+	}
+	defer f.Close()
+	for _, ns := range readDnsmasqNs(f) {
+		if ns.Transport == "tls" {
+			continue
+		}
+		t := healthTarget{Address: ns.Server, Port: ns.Port, Device: device}
+		if ns.RoutingInstance != "" {
+			t.Device = relayDevice(ns.RoutingInstance)
+		}
+		add(t)
+	}
+	return out
+}
+
+// healthyNameservers returns the statically configured name servers
+// dnsmasq should use.
+func (c *Config) healthyNameservers(conf *ConfigData) []string {
+	all := conf.plainNameservers(c.instance)
+	var out []string
+	for _, ns := range all {
+		if !c.health.isDown(ns, defaultPort) {
+			out = append(out, ns)
+		}
+	}
+	if len(out) == 0 {
+		// Keep trying all of them rather than none.
+		return all
+	}
+	return out
+}
+
+// serversFileConfig keeps the servers file dnsmasq reads the statically
+// configured name servers from.
+type serversFileConfig struct {
+	mu   sync.Mutex
+	file string
+}
+
+// Set writes servers to the file and reports whether that changed it.
+func (c *serversFileConfig) Set(servers []string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var buf bytes.Buffer
+	err := serversFileTemplate.Execute(&buf, servers)
+	if err != nil {
+		return false, err
+	}
+	return writeFileIfChanged(c.file, buf.Bytes())
+}
+
+func (c *serversFileConfig) remove() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := os.Remove(c.file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Dlog.Println("forwarding-servers-file:", err)
+	}
+}
+
+// reloadLimiter applies changes at most once per hold down, changes
+// requested in between are applied together once it has passed.
+type reloadLimiter struct {
+	mu        sync.Mutex
+	holdDown  time.Duration
+	apply     func()
+	now       func() time.Time
+	afterFunc func(time.Duration, func()) (stop func() bool)
+	last      time.Time
+	// cancel is set while an apply is pending.
+	cancel func() bool
+}
+
+func newReloadLimiter(holdDown time.Duration, apply func()) *reloadLimiter {
+	return &reloadLimiter{
+		holdDown: holdDown,
+		apply:    apply,
+		now:      time.Now,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+	}
+}
+
+func (r *reloadLimiter) request() {
+	r.mu.Lock()
+	if r.cancel != nil {
+		r.mu.Unlock()
+		return
+	}
+	now := r.now()
+	if wait := r.last.Add(r.holdDown).Sub(now); wait > 0 {
+		r.cancel = r.afterFunc(wait, r.fire)
+		r.mu.Unlock()
+		return
+	}
+	r.last = now
+	r.mu.Unlock()
+	r.apply()
+}
+
+func (r *reloadLimiter) fire() {
+	r.mu.Lock()
+	if r.cancel == nil {
+		// Stopped in the meantime.
+		r.mu.Unlock()
+		return
+	}
+	r.cancel = nil
+	r.last = r.now()
+	r.mu.Unlock()
+	r.apply()
+}
+
+// stop drops a pending apply.
+func (r *reloadLimiter) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+// updateHealthCheck starts or stops the health checker for conf.
+func (c *Config) updateHealthCheck(conf *ConfigData) error {
+	if conf.HealthCheck == nil {
+		c.health.stop()
+		c.health.reset()
+		c.healthReload.stop()
+		c.serversFile.remove()
+		return nil
+	}
+	_, err := c.serversFile.Set(c.healthyNameservers(conf))
+	if err != nil {
+		return err
+	}
+	c.health.start(*conf.HealthCheck, func() []healthTarget {
+		return c.healthTargets(conf)
+	})
+	return nil
+}
+
+// nameserverHealthChanged reports the name servers that went up or
+// down, and moves them out of the way of dnsmasq and back.
+func (c *Config) nameserverHealthChanged(changes []NameserverHealth) {
+	const logPrefix = "forwarding-health:"
+	for _, change := range changes {
+		log.Wlog.Println(logPrefix, "name server",
+			nameserverKey(change.Address, change.Port), "is", change.Status)
+	}
+	c.healthReload.request()
+	if c.notifier == nil {
+		return
+	}
+	for _, change := range changes {
+		c.notifier.NameserverStatusChanged(c.instance, change)
+	}
+}
+
+// applyHealthyNameservers updates the servers file to the health of the
+// name servers and reloads dnsmasq when that changed it.
+func (c *Config) applyHealthyNameservers() {
+	const logPrefix = "forwarding-health:"
+	conf := c.Get()
+	if conf == nil || conf.HealthCheck == nil {
+		return
+	}
+	changed, err := c.serversFile.Set(c.healthyNameservers(conf))
+	if err != nil {
+		log.Elog.Println(logPrefix, err)
+		return
+	}
+	if !changed {
+		return
+	}
+	err = c.forwardingProcess.Reload()
+	if err != nil {
+		log.Elog.Println(logPrefix, err)
+	}
+	c.notifyNameservers()
+}
+
+// mergeHealthState adds the health of each name server to state. Name
+// servers that were left out because they are down are added.
+func mergeHealthState(state *StateData, health []serverHealth) {
+	for _, h := range health {
+		var ns *NameserverState
+		for i := range state.State.Nameservers {
+			v := &state.State.Nameservers[i]
+			if v.IPAddress == h.target.Address && v.Port == h.target.Port {
+				ns = v
+				break
+			}
+		}
+		if ns == nil {
+			state.State.Nameservers = append(state.State.Nameservers,
+				NameserverState{
+					IPAddress:  h.target.Address,
+					Port:       h.target.Port,
+					Provenance: "configuration",
+				})
+			ns = &state.State.Nameservers[len(state.State.Nameservers)-1]
+		}
+		ns.Status = h.status()
+		if h.rtt > 0 {
+			ns.RoundTripTime = uint32(h.rtt / time.Millisecond)
+		}
+		if !h.lastSuccess.IsZero() {
+			ns.LastSuccess = h.lastSuccess.UTC().Format(time.RFC3339)
+		}
+	}
+}
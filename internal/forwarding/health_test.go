@@ -0,0 +1,296 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tprober struct {
+	failing map[string]bool
+}
+
+func (p *tprober) probe(target healthTarget, timeout time.Duration) (time.Duration, error) {
+	if p.failing[target.Address] {
+		return 0, errors.New("timeout")
+	}
+	return 12 * time.Millisecond, nil
+}
+
+func newTestHealthChecker(
+	prober *tprober,
+	targets []healthTarget,
+	changes *[]NameserverHealth,
+) *healthChecker {
+	h := newHealthChecker(func(c []NameserverHealth) {
+		*changes = append(*changes, c...)
+	})
+	h.probe = prober.probe
+	h.now = func() time.Time {
+		return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	}
+	h.params = HealthCheck{FailureThreshold: 2}
+	h.targets = func() []healthTarget { return targets }
+	return h
+}
+
+func TestHealthCheckerTransitions(t *testing.T) {
+	prober := &tprober{failing: map[string]bool{}}
+	var changes []NameserverHealth
+	h := newTestHealthChecker(prober, []healthTarget{
+		{Address: "8.8.8.8", Port: 53},
+		{Address: "8.8.4.4", Port: 53},
+	}, &changes)
+
+	h.check()
+	if len(changes) != 0 {
+		t.Fatal("unexpected changes for healthy name servers", changes)
+	}
+
+	prober.failing["8.8.4.4"] = true
+	h.check()
+	if len(changes) != 0 || h.isDown("8.8.4.4", 53) {
+		t.Fatal("name server down before reaching the failure threshold")
+	}
+	h.check()
+	expected := []NameserverHealth{
+		{Address: "8.8.4.4", Port: 53, Status: "down"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatal("unexpected changes", changes)
+	}
+	if !h.isDown("8.8.4.4", 53) || h.isDown("8.8.8.8", 53) {
+		t.Fatal("unexpected name server status")
+	}
+
+	changes = nil
+	delete(prober.failing, "8.8.4.4")
+	h.check()
+	if len(changes) != 0 || !h.isDown("8.8.4.4", 53) {
+		t.Fatal("name server up before answering failure-threshold probes")
+	}
+	// A failure in between starts over.
+	prober.failing["8.8.4.4"] = true
+	h.check()
+	delete(prober.failing, "8.8.4.4")
+	h.check()
+	if len(changes) != 0 {
+		t.Fatal("unexpected changes", changes)
+	}
+	h.check()
+	expected = []NameserverHealth{
+		{Address: "8.8.4.4", Port: 53, Status: "up"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatal("unexpected changes", changes)
+	}
+}
+
+func TestReloadLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	applied := 0
+	var pending func()
+	r := newReloadLimiter(30*time.Second, func() { applied++ })
+	r.now = func() time.Time { return now }
+	r.afterFunc = func(d time.Duration, f func()) func() bool {
+		if d != 20*time.Second {
+			t.Fatal("unexpected hold down", d)
+		}
+		pending = f
+		return func() bool { pending = nil; return true }
+	}
+
+	r.request()
+	if applied != 1 || pending != nil {
+		t.Fatal("first change not applied at once")
+	}
+	// Changes within the hold down are applied together once it passed.
+	now = now.Add(10 * time.Second)
+	r.request()
+	r.request()
+	if applied != 1 || pending == nil {
+		t.Fatal("changes applied within the hold down")
+	}
+	now = now.Add(20 * time.Second)
+	pending()
+	if applied != 2 {
+		t.Fatal("pending changes not applied")
+	}
+
+	// Stopping drops a pending apply.
+	pending = nil
+	now = now.Add(10 * time.Second)
+	r.request()
+	r.stop()
+	if pending != nil || applied != 2 {
+		t.Fatal("pending apply not dropped")
+	}
+}
+
+func TestHealthCheckerReportsDownAtStart(t *testing.T) {
+	prober := &tprober{failing: map[string]bool{"8.8.4.4": true}}
+	var changes []NameserverHealth
+	h := newTestHealthChecker(prober, []healthTarget{
+		{Address: "8.8.4.4", Port: 53},
+	}, &changes)
+	h.params.FailureThreshold = 1
+
+	h.check()
+	expected := []NameserverHealth{
+		{Address: "8.8.4.4", Port: 53, Status: "down"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatal("unexpected changes", changes)
+	}
+}
+
+func TestHealthyNameservers(t *testing.T) {
+	prober := &tprober{failing: map[string]bool{"8.8.4.4": true}}
+	var changes []NameserverHealth
+	conf := NewConfig()
+	conf.health = newTestHealthChecker(prober, []healthTarget{
+		{Address: "8.8.8.8", Port: 53},
+		{Address: "8.8.4.4", Port: 53},
+	}, &changes)
+	conf.health.params.FailureThreshold = 1
+	data := &ConfigData{
+		Nameservers: []string{"8.8.8.8", "8.8.4.4"},
+		HealthCheck: &HealthCheck{},
+	}
+
+	conf.health.check()
+	servers := conf.healthyNameservers(data)
+	if !reflect.DeepEqual(servers, []string{"8.8.8.8"}) {
+		t.Fatal("unexpected name servers", servers)
+	}
+
+	// All name servers are used again when all of them are down.
+	prober.failing["8.8.8.8"] = true
+	conf.health.check()
+	servers = conf.healthyNameservers(data)
+	if !reflect.DeepEqual(servers, data.Nameservers) {
+		t.Fatal("unexpected name servers", servers)
+	}
+}
+
+func TestMergeHealthState(t *testing.T) {
+	prober := &tprober{failing: map[string]bool{"8.8.4.4": true}}
+	var changes []NameserverHealth
+	h := newTestHealthChecker(prober, []healthTarget{
+		{Address: "8.8.8.8", Port: 53},
+		{Address: "8.8.4.4", Port: 53},
+	}, &changes)
+	h.params.FailureThreshold = 1
+	h.check()
+
+	state := &StateData{}
+	state.State.Nameservers = []NameserverState{
+		{
+			IPAddress:   "8.8.8.8",
+			Port:        53,
+			QueriesSent: 10,
+			Provenance:  "configuration",
+			InUse:       true,
+		},
+	}
+	mergeHealthState(state, h.get())
+	expected := []NameserverState{
+		{
+			IPAddress:     "8.8.8.8",
+			Port:          53,
+			QueriesSent:   10,
+			Provenance:    "configuration",
+			InUse:         true,
+			Status:        "up",
+			RoundTripTime: 12,
+			LastSuccess:   "2026-10-16T12:00:00Z",
+		},
+		{
+			IPAddress:  "8.8.4.4",
+			Port:       53,
+			Provenance: "configuration",
+			Status:     "down",
+		},
+	}
+	if !reflect.DeepEqual(state.State.Nameservers, expected) {
+		t.Fatal("unexpected state", state.State.Nameservers)
+	}
+}
+
+func TestWriteForwardingConfigServersFile(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("tmp")
+
+	conf := NewConfig(ServersFile("tmp/servers.conf"))
+	data := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		Nameservers:      []string{"8.8.8.8", "8.8.4.4"},
+		HealthCheck:      &HealthCheck{},
+	}
+	var buf bytes.Buffer
+	err = conf.writeForwardingConfig(&buf, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+servers-file=tmp/servers.conf
+resolv-file=/etc/dnsmasq.conf
+no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+
+	changed, err := conf.serversFile.Set([]string{"8.8.4.4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("servers file not written")
+	}
+	servers, err := ioutil.ReadFile("tmp/servers.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expectedServers = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost.
+server=8.8.4.4	# statically configured
+`
+	if string(servers) != expectedServers {
+		t.Fatal("unexpected servers file", string(servers))
+	}
+	changed, _ = conf.serversFile.Set([]string{"8.8.4.4"})
+	if changed {
+		t.Fatal("unchanged servers file rewritten")
+	}
+
+	ns := readDnsmasqNs(strings.NewReader(buf.String()))
+	expectedNs := []dnsMasqNs{
+		{Server: "8.8.4.4", Port: 53, Provenance: "configuration"},
+	}
+	if !reflect.DeepEqual(ns, expectedNs) {
+		t.Fatal("unexpected name servers", ns)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+const staticHostsFile = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+{{range . -}}
+{{$mapping := . -}}
+{{range .Addresses -}}
+{{.}}	{{$mapping.HostName}}{{range $mapping.Aliases}} {{.}}{{end}}
+{{end -}}
+{{end -}}
+`
+
+var staticHostsFileTemplate *template.Template
+
+func init() {
+	t := template.New("StaticHosts")
+	t.Funcs(template.FuncMap{})
+	staticHostsFileTemplate = template.Must(t.Parse(staticHostsFile))
+}
+
+type StaticHostMapping struct {
+	HostName  string   `rfc7951:"host-name"`
+	Addresses []string `rfc7951:"address,omitempty"`
+	Aliases   []string `rfc7951:"alias,omitempty"`
+}
+
+func writeStaticHosts(w io.Writer, mappings []StaticHostMapping) error {
+	return staticHostsFileTemplate.Execute(w, mappings)
+}
+
+// updateStaticHosts renders the static host mappings into the hosts
+// file of the instance. The file is only rewritten when its content
+// changes, the change then has dnsmasq reloaded.
+func (c *Config) updateStaticHosts(conf *ConfigData) error {
+	if len(conf.StaticHostMappings) == 0 {
+		c.removeStaticHosts()
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err := writeStaticHosts(&buf, conf.StaticHostMappings)
+	if err != nil {
+		return err
+	}
+	cur, err := ioutil.ReadFile(c.statichostsfile)
+	if err != nil || !bytes.Equal(cur, buf.Bytes()) {
+		err = os.MkdirAll(filepath.Dir(c.statichostsfile), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(c.statichostsfile, buf.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) removeStaticHosts() {
+	err := os.Remove(c.statichostsfile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Dlog.Println("static-hosts:", err)
+	}
+}
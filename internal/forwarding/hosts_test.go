@@ -0,0 +1,154 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/process"
+)
+
+var testStaticHostMappings = []StaticHostMapping{
+	{
+		HostName:  "router.example.net",
+		Addresses: []string{"192.0.2.1", "2001:db8::1"},
+		Aliases:   []string{"router", "gw"},
+	},
+	{
+		HostName:  "printer.example.net",
+		Addresses: []string{"192.0.2.20"},
+	},
+}
+
+func TestWriteStaticHosts(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeStaticHosts(&buf, testStaticHostMappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+192.0.2.1	router.example.net router gw
+2001:db8::1	router.example.net router gw
+192.0.2.20	printer.example.net
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestConfigObjectSetWithStaticHostMappings(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log")
+	conf := newTestConfig(processConstructor(
+		func(string) process.Process {
+			return proc
+		}))
+
+	err = conf.Set(&ConfigData{
+		CacheSize:          150,
+		ListenInterfaces:   []string{"eth0"},
+		StaticHostMappings: testStaticHostMappings,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+	if !strings.Contains(proc.conf, "addn-hosts=tmp/static-hosts\n") {
+		t.Fatal("static hosts file not used:", proc.conf)
+	}
+	hosts, err := ioutil.ReadFile("tmp/static-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(hosts), "192.0.2.20\tprinter.example.net\n") {
+		t.Fatal("static hosts file not written:", string(hosts))
+	}
+
+	err = conf.Set(&ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+	if strings.Contains(proc.conf, "tmp/static-hosts") {
+		t.Fatal("static hosts file still used:", proc.conf)
+	}
+	if _, err := os.Stat("tmp/static-hosts"); !os.IsNotExist(err) {
+		t.Fatal("static hosts file not removed")
+	}
+}
+
+// reloadCountingTproc counts how often dnsmasq is reloaded.
+type reloadCountingTproc struct {
+	*tproc
+	reloads int32
+}
+
+func (p *reloadCountingTproc) Reload() error {
+	atomic.AddInt32(&p.reloads, 1)
+	return nil
+}
+
+func TestConfigObjectSetStaticHostMappingsReloadsOnce(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.RemoveAll("tmp")
+	}()
+	proc := &reloadCountingTproc{
+		tproc: newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log"),
+	}
+	conf := newTestConfig(processConstructor(
+		func(string) process.Process {
+			return proc
+		}))
+
+	err = conf.Set(&ConfigData{
+		CacheSize:          150,
+		ListenInterfaces:   []string{"eth0"},
+		StaticHostMappings: testStaticHostMappings,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-proc.actions
+
+	err = conf.Set(&ConfigData{
+		CacheSize:          150,
+		ListenInterfaces:   []string{"eth0"},
+		StaticHostMappings: testStaticHostMappings[:1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Give anything watching the file the time to reload too.
+	time.Sleep(500 * time.Millisecond)
+	if reloads := atomic.LoadInt32(&proc.reloads); reloads != 1 {
+		t.Fatal("expected one reload, got", reloads)
+	}
+	select {
+	case act := <-proc.actions:
+		t.Fatal("unexpected", act)
+	default:
+	}
+}
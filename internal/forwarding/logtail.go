@@ -0,0 +1,114 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/danos/vyatta-service-dns/internal/fswatcher"
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+// Once the log has grown past this size it is truncated after it has
+// been read, query logging would otherwise fill the disk.
+const maxLogSize = 8 * 1024 * 1024
+
+// logTail follows the dnsmasq log file and hands each new line to
+// handler. The file may be truncated underneath it at any time,
+// truncated is then called as lines may have been lost.
+type logTail struct {
+	mu        sync.Mutex
+	file      string
+	offset    int64
+	partial   []byte
+	handler   func(string)
+	truncated func()
+	watcher   *fswatcher.Watcher
+}
+
+func startLogTail(file string, handler func(string), truncated func()) *logTail {
+	if truncated == nil {
+		truncated = func() {}
+	}
+	out := &logTail{
+		file:      file,
+		handler:   handler,
+		truncated: truncated,
+	}
+	if fi, err := os.Stat(file); err == nil {
+		// Only lines logged from now on are of interest.
+		out.offset = fi.Size()
+	}
+	out.watcher = fswatcher.Start(
+		fswatcher.LogPrefix("dnsmasq log tail:"),
+		fswatcher.Logger(log.Dlog),
+		fswatcher.Handler(file, out),
+	)
+	return out
+}
+
+func (t *logTail) Write(name string) error {
+	if name != t.file {
+		return nil
+	}
+	return t.read()
+}
+
+func (t *logTail) read() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, err := os.Open(t.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < t.offset {
+		t.offset = 0
+		t.partial = nil
+		t.truncated()
+	}
+	_, err = f.Seek(t.offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	t.offset += int64(len(data))
+
+	data = append(t.partial, data...)
+	lines := bytes.Split(data, []byte{'\n'})
+	t.partial = append([]byte(nil), lines[len(lines)-1]...)
+	for _, line := range lines[:len(lines)-1] {
+		t.handler(string(line))
+	}
+
+	if t.offset > maxLogSize {
+		err = os.Truncate(t.file, 0)
+		if err != nil {
+			return err
+		}
+		t.offset = 0
+		// dnsmasq may have logged after the log was read.
+		t.truncated()
+	}
+	return nil
+}
+
+func (t *logTail) stop() {
+	if t == nil {
+		return
+	}
+	t.watcher.Stop()
+}
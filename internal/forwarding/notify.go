@@ -0,0 +1,83 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"os"
+	"reflect"
+
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+// ActiveNameserver is an upstream name server that the forwarder
+// will send queries to that are not covered by a domain override.
+type ActiveNameserver struct {
+	Address string `rfc7951:"address"`
+	Port    uint16 `rfc7951:"port"`
+}
+
+// Notifier is told whenever the set of active name servers of a
+// forwarding instance changes and whenever a health checked name
+// server goes up or down.
+type Notifier interface {
+	NameserversUpdated(instance string, nameservers []ActiveNameserver)
+	NameserverStatusChanged(instance string, status NameserverHealth)
+}
+
+func Notifications(n Notifier) ConfigOption {
+	return func(c *Config) {
+		c.notifier = n
+	}
+}
+
+func (c *Config) activeNameservers() []ActiveNameserver {
+	const logPrefix = "forwarding-active-nameservers:"
+	var out []ActiveNameserver
+
+	dnsmasqFile, err := os.Open(c.conffile)
+	if err != nil {
+		log.Dlog.Println(logPrefix, err)
+		return nil
+	}
+	defer dnsmasqFile.Close()
+	for _, ns := range readDnsmasqNs(dnsmasqFile) {
+		if ns.Domain != "" {
+			continue
+		}
+		out = append(out, ActiveNameserver{Address: ns.Server, Port: ns.Port})
+	}
+	if len(out) != 0 {
+		return out
+	}
+
+	// Without any servers in the dnsmasq configuration the
+	// resolver configuration is used instead.
+	resolvFile, err := os.Open(c.resolvfile)
+	if err != nil {
+		log.Dlog.Println(logPrefix, err)
+		return nil
+	}
+	defer resolvFile.Close()
+	for _, ns := range readResolvNs(resolvFile) {
+		out = append(out, ActiveNameserver{Address: ns, Port: 53})
+	}
+	return out
+}
+
+func (c *Config) notifyNameservers() {
+	if c.notifier == nil {
+		return
+	}
+	var active []ActiveNameserver
+	if c.Get() != nil {
+		active = c.activeNameservers()
+	}
+
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	if reflect.DeepEqual(active, c.lastActive) {
+		return
+	}
+	c.lastActive = active
+	c.notifier.NameserversUpdated(c.instance, active)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"sort"
+)
+
+// Name servers without a priority sort after those with a higher
+// preference (lower value) and before those with a lower one.
+const defaultNameserverPriority = 100
+
+// Forwarding policies, dnsmasq picks the fastest name server unless
+// told otherwise.
+const (
+	policyFastest     = "fastest"
+	policyStrictOrder = "strict-order"
+	policyAllServers  = "all-servers"
+)
+
+func (c *ConfigData) forwardingPolicy() string {
+	if c.ForwardingPolicy == "" {
+		return policyFastest
+	}
+	return c.ForwardingPolicy
+}
+
+func (c *ConfigData) nameserverPriority(addr string) uint32 {
+	params := c.nameserverParameters(addr)
+	if params == nil || params.Priority == 0 {
+		return defaultNameserverPriority
+	}
+	return params.Priority
+}
+
+// orderedNameservers returns the statically configured name servers by
+// priority, name servers of the same priority stay in configuration
+// order.
+func (c *ConfigData) orderedNameservers() []string {
+	out := append([]string(nil), c.Nameservers...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return c.nameserverPriority(out[i]) < c.nameserverPriority(out[j])
+	})
+	return out
+}
+
+// upstream is a line of the dnsmasq configuration the statically
+// configured name servers are forwarded to. The TLS proxy and the
+// servers file take the place of the first name server they cover.
+type upstream struct {
+	Address     string
+	TLS         bool
+	ServersFile bool
+	Relay       *relayedNameserver
+}
+
+func (c *ConfigData) upstreams(instance string, serversFile bool) []upstream {
+	relays := make(map[string]relayedNameserver)
+	for _, ns := range c.relayedNameservers(instance) {
+		relays[ns.Address] = ns
+	}
+	var out []upstream
+	var haveTLS, haveServersFile bool
+	for _, ns := range c.orderedNameservers() {
+		switch {
+		case c.useTLS(ns):
+			if !haveTLS {
+				out = append(out, upstream{TLS: true})
+				haveTLS = true
+			}
+		case c.useRelay(ns, instance):
+			relay := relays[ns]
+			out = append(out, upstream{Address: ns, Relay: &relay})
+		case serversFile:
+			if !haveServersFile {
+				out = append(out, upstream{ServersFile: true})
+				haveServersFile = true
+			}
+		default:
+			out = append(out, upstream{Address: ns})
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteForwardingConfigPolicy(t *testing.T) {
+	data := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		Nameservers: []string{
+			"192.0.2.1", "192.0.2.2", "1.1.1.1", "192.0.2.3", "10.0.0.53",
+		},
+		ForwardingPolicy: "strict-order",
+		NameserverParameters: []NameserverParameters{
+			{Address: "192.0.2.3", Priority: 10},
+			{Address: "1.1.1.1", Transport: "tls", Priority: 10},
+			{Address: "192.0.2.1", Priority: 200},
+			{Address: "10.0.0.53", RoutingInstance: "blue"},
+		},
+	}
+	var buf bytes.Buffer
+	err := NewConfig().writeForwardingConfig(&buf, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+strict-order
+server=127.0.0.1#8853	# tls-proxy 1.1.1.1
+server=192.0.2.3	# statically configured
+server=192.0.2.2	# statically configured
+server=127.0.0.1#8927	# relay blue 10.0.0.53
+server=192.0.2.1	# statically configured
+resolv-file=/etc/dnsmasq.conf
+no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestWriteForwardingConfigAllServers(t *testing.T) {
+	data := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		Nameservers:      []string{"192.0.2.1"},
+		ForwardingPolicy: "all-servers",
+	}
+	var buf bytes.Buffer
+	err := NewConfig().writeForwardingConfig(&buf, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+all-servers
+server=192.0.2.1	# statically configured
+resolv-file=/etc/dnsmasq.conf
+no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+const (
+	defaultQueryLogRate     = 100
+	defaultQueryLogFileSize = 10240
+	defaultQueryLogFiles    = 3
+	// Queries whose answer was never logged are dropped once this
+	// many are pending.
+	maxPendingQueries = 4096
+)
+
+type QueryLog struct {
+	Destination string `rfc7951:"destination,omitempty"`
+	// RateLimit is the number of records exported per second.
+	RateLimit uint32 `rfc7951:"rate-limit,omitempty"`
+	// MaxFileSize is the size in KiB at which the file is rotated.
+	MaxFileSize uint32 `rfc7951:"max-file-size,omitempty"`
+	// Files is the number of rotated files kept.
+	Files uint32 `rfc7951:"files,omitempty"`
+}
+
+func (q *QueryLog) rateLimit() uint32 {
+	if q.RateLimit == 0 {
+		return defaultQueryLogRate
+	}
+	return q.RateLimit
+}
+
+func (q *QueryLog) maxFileSize() int64 {
+	if q.MaxFileSize == 0 {
+		return defaultQueryLogFileSize * 1024
+	}
+	return int64(q.MaxFileSize) * 1024
+}
+
+func (q *QueryLog) files() int {
+	if q.Files == 0 {
+		return defaultQueryLogFiles
+	}
+	return int(q.Files)
+}
+
+// QueryRecord is a query and how it was answered.
+type QueryRecord struct {
+	Time     string `json:"time"`
+	Instance string `json:"instance"`
+	Client   string `json:"client"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Upstream string `json:"upstream,omitempty"`
+	Rcode    string `json:"rcode"`
+	// Source is cached, forwarded or local.
+	Source string `json:"source"`
+}
+
+// With log-queries=extra dnsmasq prefixes every line logged for a query
+// with a serial number and the client address and port, e.g.
+// "7 192.0.2.10/41234 query[A] example.com from 192.0.2.10".
+var queryLogExp = regexp.MustCompile(
+	`: (\d+) (\S+)/\d+ (query\[([A-Z0-9]+)\]|forwarded|reply|cached|config) (\S+) (?:from|to|is) (.*)$`)
+
+func answerRcode(answer string) string {
+	switch answer {
+	case "NXDOMAIN", "SERVFAIL", "REFUSED":
+		return answer
+	}
+	return "NOERROR"
+}
+
+// queryLogParser assembles records from the lines dnsmasq logs for a
+// query, a record is complete with the first answer.
+type queryLogParser struct {
+	mu       sync.Mutex
+	instance string
+	now      func() time.Time
+	pending  map[string]*QueryRecord
+}
+
+func (p *queryLogParser) readLine(line string) *QueryRecord {
+	match := queryLogExp.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	serial, action, name, arg := match[1], match[3], match[5], match[6]
+	if qtype := match[4]; qtype != "" {
+		if len(p.pending) >= maxPendingQueries {
+			p.pending = nil
+		}
+		if p.pending == nil {
+			p.pending = make(map[string]*QueryRecord)
+		}
+		p.pending[serial] = &QueryRecord{
+			Instance: p.instance,
+			Client:   match[2],
+			Name:     name,
+			Type:     qtype,
+		}
+		return nil
+	}
+	rec, ok := p.pending[serial]
+	if !ok {
+		return nil
+	}
+	switch action {
+	case "forwarded":
+		rec.Upstream = arg
+		return nil
+	case "reply":
+		rec.Source = "forwarded"
+	case "cached":
+		rec.Source = "cached"
+	case "config":
+		rec.Source = "local"
+	}
+	delete(p.pending, serial)
+	rec.Rcode = answerRcode(arg)
+	rec.Time = p.now().UTC().Format(time.RFC3339)
+	return rec
+}
+
+// rateLimiter is a token bucket refilled with rate tokens per second.
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) allow(now time.Time) bool {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+	} else {
+		l.tokens = l.rate
+	}
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// syslogRecord renders rec in the form of RFC 5424 structured data.
+func syslogRecord(rec *QueryRecord) string {
+	var b strings.Builder
+	b.WriteString("[query")
+	for _, param := range []struct{ name, value string }{
+		{"instance", rec.Instance},
+		{"client", rec.Client},
+		{"name", rec.Name},
+		{"type", rec.Type},
+		{"upstream", rec.Upstream},
+		{"rcode", rec.Rcode},
+		{"source", rec.Source},
+	} {
+		if param.value == "" {
+			continue
+		}
+		fmt.Fprintf(&b, " %s=%s", param.name, strconv.Quote(param.value))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// rotatingFile appends to a file and rotates it once it grows past
+// maxSize, keeping files rotated copies as file.1 to file.<files>.
+type rotatingFile struct {
+	file    string
+	maxSize int64
+	files   int
+	f       *os.File
+	size    int64
+}
+
+func (r *rotatingFile) open() error {
+	err := os.MkdirAll(filepath.Dir(r.file), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	r.close()
+	for i := r.files; i > 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.file, i-1),
+			fmt.Sprintf("%s.%d", r.file, i))
+	}
+	err := os.Rename(r.file, r.file+".1")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Write(data []byte) (int, error) {
+	if r.f == nil {
+		err := r.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if r.size > 0 && r.size+int64(len(data)) > r.maxSize {
+		err := r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(data)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) close() {
+	if r.f == nil {
+		return
+	}
+	r.f.Close()
+	r.f = nil
+}
+
+// queryLogger exports the queries dnsmasq logs.
+type queryLogger struct {
+	mu      sync.Mutex
+	params  QueryLog
+	limiter rateLimiter
+	dropped uint64
+	now     func() time.Time
+	syslog  func(string)
+	file    *rotatingFile
+	out     io.Writer
+	closed  bool
+}
+
+func newQueryLogger(file string, params QueryLog) *queryLogger {
+	l := &queryLogger{
+		params:  params,
+		limiter: rateLimiter{rate: float64(params.rateLimit())},
+		now:     time.Now,
+		syslog: func(msg string) {
+			log.Ilog.Println("dns-query-log:", msg)
+		},
+	}
+	if params.Destination == "file" {
+		l.file = &rotatingFile{
+			file:    file,
+			maxSize: params.maxFileSize(),
+			files:   params.files(),
+		}
+		l.out = l.file
+	}
+	return l
+}
+
+func (l *queryLogger) export(rec *QueryRecord) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	if !l.limiter.allow(l.now()) {
+		l.dropped++
+		return
+	}
+	if l.dropped > 0 {
+		log.Wlog.Println("dns-query-log: rate limit exceeded, dropped",
+			l.dropped, "records")
+		l.dropped = 0
+	}
+	if l.out == nil {
+		l.syslog(syslogRecord(rec))
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err == nil {
+		_, err = l.out.Write(append(data, '\n'))
+	}
+	if err != nil {
+		log.Dlog.Println("dns-query-log:", err)
+	}
+}
+
+func (l *queryLogger) close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.file != nil {
+		l.file.close()
+	}
+}
+
+func (c *Config) getQueryLogger() *queryLogger {
+	return c.queryLogger.Load().(*queryLogger)
+}
+
+func (c *Config) updateQueryLogger(conf *ConfigData) {
+	cur := c.getQueryLogger()
+	if conf == nil || conf.QueryLog == nil {
+		c.queryLogger.Store((*queryLogger)(nil))
+		cur.close()
+		return
+	}
+	if cur != nil && cur.params == *conf.QueryLog {
+		return
+	}
+	c.queryLogger.Store(newQueryLogger(c.querylogfile, *conf.QueryLog))
+	cur.close()
+}
+
+// readQueryLine passes the queries logged by dnsmasq to the query log
+// and the top talkers.
+func (c *Config) readQueryLine(line string) {
+	logger, talkers := c.getQueryLogger(), c.getTopTalkers()
+	if logger == nil && talkers == nil {
+		return
+	}
+	rec := c.queryParser.readLine(line)
+	if rec == nil {
+		return
+	}
+	logger.export(rec)
+	talkers.add(rec)
+}
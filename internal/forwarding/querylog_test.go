@@ -0,0 +1,153 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const queryLogSample = `Oct 16 10:00:01 dnsmasq[812]: 7 192.0.2.10/41234 query[A] example.com from 192.0.2.10
+Oct 16 10:00:01 dnsmasq[812]: 7 192.0.2.10/41234 forwarded example.com to 8.8.8.8
+Oct 16 10:00:01 dnsmasq[812]: 8 192.0.2.11/5300 query[AAAA] example.com from 192.0.2.11
+Oct 16 10:00:01 dnsmasq[812]: 8 192.0.2.11/5300 cached example.com is NODATA-IPv6
+Oct 16 10:00:01 dnsmasq[812]: 7 192.0.2.10/41234 reply example.com is <CNAME>
+Oct 16 10:00:01 dnsmasq[812]: 7 192.0.2.10/41234 reply www.example.com is 93.184.216.34
+Oct 16 10:00:02 dnsmasq[812]: 9 192.0.2.10/41235 query[A] x.ads.example from 192.0.2.10
+Oct 16 10:00:02 dnsmasq[812]: 9 192.0.2.10/41235 config x.ads.example is NXDOMAIN
+Oct 16 10:00:03 dnsmasq[812]: 10 192.0.2.12/41236 query[MX] missing.example from 192.0.2.12
+Oct 16 10:00:03 dnsmasq[812]: 10 192.0.2.12/41236 forwarded missing.example to 2001:db8::53
+Oct 16 10:00:03 dnsmasq[812]: 10 192.0.2.12/41236 reply missing.example is NXDOMAIN
+Oct 16 10:00:04 dnsmasq[812]: server 8.8.8.8#53: queries sent 2, retried or failed 0
+`
+
+func TestQueryLogParser(t *testing.T) {
+	p := &queryLogParser{
+		instance: "blue",
+		now: func() time.Time {
+			return time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+		},
+	}
+	var records []QueryRecord
+	for _, line := range strings.Split(queryLogSample, "\n") {
+		if rec := p.readLine(line); rec != nil {
+			records = append(records, *rec)
+		}
+	}
+	const now = "2026-10-16T10:00:00Z"
+	expected := []QueryRecord{
+		{Time: now, Instance: "blue", Client: "192.0.2.11",
+			Name: "example.com", Type: "AAAA",
+			Rcode: "NOERROR", Source: "cached"},
+		{Time: now, Instance: "blue", Client: "192.0.2.10",
+			Name: "example.com", Type: "A", Upstream: "8.8.8.8",
+			Rcode: "NOERROR", Source: "forwarded"},
+		{Time: now, Instance: "blue", Client: "192.0.2.10",
+			Name: "x.ads.example", Type: "A",
+			Rcode: "NXDOMAIN", Source: "local"},
+		{Time: now, Instance: "blue", Client: "192.0.2.12",
+			Name: "missing.example", Type: "MX", Upstream: "2001:db8::53",
+			Rcode: "NXDOMAIN", Source: "forwarded"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Log("got", records)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected records")
+	}
+	if len(p.pending) != 0 {
+		t.Fatal("records left pending", p.pending)
+	}
+}
+
+func TestSyslogRecord(t *testing.T) {
+	rec := &QueryRecord{
+		Instance: "default",
+		Client:   "192.0.2.10",
+		Name:     "example.com",
+		Type:     "A",
+		Rcode:    "NOERROR",
+		Source:   "cached",
+	}
+	const expected = `[query instance="default" client="192.0.2.10" name="example.com" type="A" rcode="NOERROR" source="cached"]`
+	if got := syslogRecord(rec); got != expected {
+		t.Fatal("unexpected record", got)
+	}
+}
+
+func TestQueryLoggerRateLimit(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	l := newQueryLogger("", QueryLog{RateLimit: 2})
+	l.now = func() time.Time { return now }
+	var exported []string
+	l.syslog = func(msg string) { exported = append(exported, msg) }
+
+	p := &queryLogParser{instance: "default", now: l.now}
+	lines := func(serial string) {
+		p.readLine("dnsmasq[812]: " + serial +
+			" 192.0.2.10/1 query[A] example.com from 192.0.2.10")
+		l.export(p.readLine("dnsmasq[812]: " + serial +
+			" 192.0.2.10/1 cached example.com is 192.0.2.1"))
+	}
+	for _, serial := range []string{"1", "2", "3"} {
+		lines(serial)
+	}
+	if len(exported) != 2 || l.dropped != 1 {
+		t.Fatal("rate limit not applied", exported, l.dropped)
+	}
+	now = now.Add(time.Second)
+	lines("4")
+	if len(exported) != 3 || l.dropped != 0 {
+		t.Fatal("rate limit not refilled", exported, l.dropped)
+	}
+}
+
+func TestQueryLoggerFile(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("tmp")
+
+	l := newQueryLogger("tmp/queries.json", QueryLog{
+		Destination: "file",
+		Files:       1,
+	})
+	p := &queryLogParser{
+		instance: "default",
+		now: func() time.Time {
+			return time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+		},
+	}
+	// Rotate after every record.
+	l.file.maxSize = 1
+	for _, line := range strings.Split(queryLogSample, "\n") {
+		if rec := p.readLine(line); rec != nil {
+			l.export(rec)
+		}
+	}
+	l.close()
+
+	data, err := ioutil.ReadFile("tmp/queries.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{"time":"2026-10-16T10:00:00Z","instance":"default","client":"192.0.2.12","name":"missing.example","type":"MX","upstream":"2001:db8::53","rcode":"NXDOMAIN","source":"forwarded"}
+`
+	if string(data) != expected {
+		t.Fatal("unexpected query log", string(data))
+	}
+	rotated, err := ioutil.ReadFile("tmp/queries.json.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(rotated), `"name":"x.ads.example"`) {
+		t.Fatal("unexpected rotated query log", string(rotated))
+	}
+	if _, err := os.Stat("tmp/queries.json.2"); !os.IsNotExist(err) {
+		t.Fatal("more rotated files than configured")
+	}
+}
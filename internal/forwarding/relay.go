@@ -0,0 +1,377 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+// dnsmasq runs inside the routing instance of its forwarding instance
+// and can't reach name servers in another one. The service relays
+// queries for those name servers: it listens on the loopback address
+// of the instance and sends the queries on from a socket bound to the
+// routing instance of the name server.
+const (
+	relayAddress  = "127.0.0.1"
+	relayBasePort = 8900
+	// relayPorts is the number of ports from relayBasePort relays
+	// listen on.
+	relayPorts   = 100
+	relayTimeout = 5 * time.Second
+	relayMaxMsg  = 65535
+	// relayMaxInFlight bounds the queries and connections a relay
+	// handles at once, beyond that they are dropped and left to the
+	// retries of dnsmasq.
+	relayMaxInFlight = 128
+)
+
+var relayBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, relayMaxMsg)
+		return &buf
+	},
+}
+
+// relayedNameserver is a name server in another routing instance and
+// the port its relay listens on.
+type relayedNameserver struct {
+	Address         string
+	RoutingInstance string
+	Port            uint16
+}
+
+func (c *ConfigData) useRelay(addr, instance string) bool {
+	params := c.nameserverParameters(addr)
+	return params != nil && params.RoutingInstance != "" &&
+		params.RoutingInstance != instance
+}
+
+// validateNameserverParameters checks combinations the relay can't
+// provide.
+func (c *ConfigData) validateNameserverParameters() error {
+	relayed := 0
+	for _, params := range c.NameserverParameters {
+		if params.RoutingInstance != "" {
+			relayed++
+		}
+		if relayed > relayPorts {
+			return &ConfigError{
+				Path: "name-server-parameters/" + params.Address +
+					"/routing-instance",
+				Message: "at most " + strconv.Itoa(relayPorts) +
+					" name servers can be in other routing instances",
+			}
+		}
+		if params.Transport == "tls" && params.RoutingInstance != "" {
+			return &ConfigError{
+				Path: "name-server-parameters/" + params.Address +
+					"/routing-instance",
+				Message: "name servers in another routing instance " +
+					"cannot be reached over TLS",
+			}
+		}
+	}
+	return nil
+}
+
+// relayedNameservers returns the statically configured name servers
+// that are reached through a relay, by priority. A name server in the
+// routing instance of the forwarding instance itself needs no relay.
+func (c *ConfigData) relayedNameservers(instance string) []relayedNameserver {
+	var out []relayedNameserver
+	for _, ns := range c.orderedNameservers() {
+		if !c.useRelay(ns, instance) {
+			continue
+		}
+		out = append(out, relayedNameserver{
+			Address:         ns,
+			RoutingInstance: c.nameserverParameters(ns).RoutingInstance,
+		})
+	}
+	assignRelayPorts(out)
+	return out
+}
+
+func (ns *relayedNameserver) key() string {
+	return ns.RoutingInstance + "/" + ns.Address
+}
+
+// assignRelayPorts derives the port of each relay from the name server
+// it relays to, so that the ports and with them the configuration of
+// dnsmasq stay the same when other name servers are added, removed or
+// given another priority. Collisions take the next free port, in the
+// order of the name servers' addresses.
+func assignRelayPorts(servers []relayedNameserver) {
+	byKey := make([]*relayedNameserver, len(servers))
+	for i := range servers {
+		byKey[i] = &servers[i]
+	}
+	sort.Slice(byKey, func(i, j int) bool {
+		return byKey[i].key() < byKey[j].key()
+	})
+	taken := make(map[uint16]bool)
+	for _, ns := range byKey {
+		h := fnv.New32a()
+		h.Write([]byte(ns.key()))
+		off := h.Sum32() % relayPorts
+		for i := uint32(0); i < relayPorts; i++ {
+			port := uint16(relayBasePort + (off+i)%relayPorts)
+			if !taken[port] {
+				taken[port] = true
+				ns.Port = port
+				break
+			}
+		}
+	}
+}
+
+// relayDevice returns the device sockets of instance are bound to,
+// the default instance needs none.
+func relayDevice(instance string) string {
+	if instance == "" || instance == "default" {
+		return ""
+	}
+	return vrfDevice(instance)
+}
+
+type relay struct {
+	upstream string
+	device   string
+	udp      net.PacketConn
+	tcp      net.Listener
+	wg       sync.WaitGroup
+	inFlight chan struct{}
+}
+
+func startRelay(instance string, ns relayedNameserver) (*relay, error) {
+	return listenRelay(
+		relayDevice(instance),
+		net.JoinHostPort(relayAddress, strconv.Itoa(int(ns.Port))),
+		relayDevice(ns.RoutingInstance),
+		net.JoinHostPort(ns.Address, strconv.Itoa(defaultPort)))
+}
+
+// listenRelay relays queries received on listen in listenDevice to
+// upstream in device.
+func listenRelay(listenDevice, listen, device, upstream string) (*relay, error) {
+	r := &relay{
+		upstream: upstream,
+		device:   device,
+		inFlight: make(chan struct{}, relayMaxInFlight),
+	}
+	lc := net.ListenConfig{
+		Control: func(network, address string, rc syscall.RawConn) error {
+			return dnsclient.BindToDevice(rc, listenDevice)
+		},
+	}
+	var err error
+	r.udp, err = lc.ListenPacket(context.Background(), "udp", listen)
+	if err != nil {
+		return nil, err
+	}
+	r.tcp, err = lc.Listen(context.Background(), "tcp", listen)
+	if err != nil {
+		r.udp.Close()
+		return nil, err
+	}
+	r.wg.Add(2)
+	go r.serveUDP()
+	go r.serveTCP()
+	return r, nil
+}
+
+func (r *relay) stop() {
+	r.udp.Close()
+	r.tcp.Close()
+	r.wg.Wait()
+}
+
+func (r *relay) dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: relayTimeout,
+		Control: func(network, address string, rc syscall.RawConn) error {
+			return dnsclient.BindToDevice(rc, r.device)
+		},
+	}
+}
+
+// acquire reserves one of the queries a relay handles at once.
+func (r *relay) acquire() bool {
+	select {
+	case r.inFlight <- struct{}{}:
+		return true
+	default:
+		log.Dlog.Println("forwarding-relay:", r.upstream,
+			"too many queries in flight, dropped")
+		return false
+	}
+}
+
+func (r *relay) release() {
+	<-r.inFlight
+}
+
+func (r *relay) serveUDP() {
+	defer r.wg.Done()
+	for {
+		buf := relayBuffers.Get().(*[]byte)
+		n, client, err := r.udp.ReadFrom(*buf)
+		if err != nil {
+			relayBuffers.Put(buf)
+			return
+		}
+		if !r.acquire() {
+			relayBuffers.Put(buf)
+			continue
+		}
+		go func() {
+			defer relayBuffers.Put(buf)
+			defer r.release()
+			r.relayUDP((*buf)[:n], client)
+		}()
+	}
+}
+
+func (r *relay) relayUDP(query []byte, client net.Addr) {
+	conn, err := r.dialer().Dial("udp", r.upstream)
+	if err != nil {
+		log.Dlog.Println("forwarding-relay:", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(relayTimeout))
+	_, err = conn.Write(query)
+	if err != nil {
+		log.Dlog.Println("forwarding-relay:", err)
+		return
+	}
+	buf := relayBuffers.Get().(*[]byte)
+	defer relayBuffers.Put(buf)
+	n, err := conn.Read(*buf)
+	if err != nil {
+		// dnsmasq retries and counts the failure itself.
+		log.Dlog.Println("forwarding-relay:", err)
+		return
+	}
+	_, err = r.udp.WriteTo((*buf)[:n], client)
+	if err != nil {
+		log.Dlog.Println("forwarding-relay:", err)
+	}
+}
+
+func (r *relay) serveTCP() {
+	defer r.wg.Done()
+	for {
+		client, err := r.tcp.Accept()
+		if err != nil {
+			return
+		}
+		if !r.acquire() {
+			client.Close()
+			continue
+		}
+		go func() {
+			defer r.release()
+			r.relayTCP(client)
+		}()
+	}
+}
+
+func (r *relay) relayTCP(client net.Conn) {
+	defer client.Close()
+	upstream, err := r.dialer().Dial("tcp", r.upstream)
+	if err != nil {
+		log.Dlog.Println("forwarding-relay:", err)
+		return
+	}
+	defer upstream.Close()
+	// dnsmasq keeps no idle connections, the deadline bounds a
+	// connection that was abandoned.
+	deadline := time.Now().Add(6 * relayTimeout)
+	client.SetDeadline(deadline)
+	upstream.SetDeadline(deadline)
+	done := make(chan struct{})
+	go func() {
+		io.Copy(upstream, client)
+		upstream.(*net.TCPConn).CloseWrite()
+		close(done)
+	}()
+	io.Copy(client, upstream)
+	<-done
+}
+
+// relayConfig runs the relays of an instance.
+type relayConfig struct {
+	instance string
+	relays   map[relayedNameserver]*relay
+}
+
+func (c *relayConfig) Set(servers []relayedNameserver) error {
+	keep := make(map[relayedNameserver]struct{})
+	for _, ns := range servers {
+		keep[ns] = struct{}{}
+	}
+	for ns, r := range c.relays {
+		if _, ok := keep[ns]; ok {
+			continue
+		}
+		r.stop()
+		delete(c.relays, ns)
+	}
+	if c.relays == nil {
+		c.relays = make(map[relayedNameserver]*relay)
+	}
+	for _, ns := range servers {
+		if _, ok := c.relays[ns]; ok {
+			continue
+		}
+		r, err := startRelay(c.instance, ns)
+		if err != nil {
+			return err
+		}
+		c.relays[ns] = r
+	}
+	return nil
+}
+
+// mergeRelayState replaces the statistics dnsmasq keeps for each relay
+// with the name server behind it.
+func mergeRelayState(state *StateData, relays []relayedNameserver) {
+	byPort := make(map[uint16]relayedNameserver)
+	for _, ns := range relays {
+		byPort[ns.Port] = ns
+	}
+	var proxies []NameserverState
+	var nameservers []NameserverState
+	for _, ns := range state.State.Nameservers {
+		if _, ok := byPort[ns.Port]; ok && ns.IPAddress == relayAddress {
+			proxies = append(proxies, ns)
+			continue
+		}
+		nameservers = append(nameservers, ns)
+	}
+	for _, proxy := range proxies {
+		relayed := byPort[proxy.Port]
+		for i := range nameservers {
+			ns := &nameservers[i]
+			if ns.IPAddress != relayed.Address ||
+				ns.RoutingInstance != relayed.RoutingInstance {
+				continue
+			}
+			ns.QueriesSent = proxy.QueriesSent
+			ns.QueriesRetriedOrFailed = proxy.QueriesRetriedOrFailed
+		}
+	}
+	state.State.Nameservers = nameservers
+}
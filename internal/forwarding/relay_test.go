@@ -0,0 +1,249 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func relayTestConfig() *ConfigData {
+	return &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		Nameservers:      []string{"10.0.0.53", "192.168.1.53", "10.1.0.53"},
+		NameserverParameters: []NameserverParameters{
+			{Address: "10.0.0.53", RoutingInstance: "shared"},
+			{Address: "192.168.1.53", RoutingInstance: "blue"},
+			{Address: "10.1.0.53", RoutingInstance: "default"},
+		},
+	}
+}
+
+func TestWriteForwardingConfigRelay(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewConfig(InstanceName("blue")).
+		writeForwardingConfig(&buf, relayTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+server=127.0.0.1#8962	# relay shared 10.0.0.53
+server=192.168.1.53	# statically configured
+server=127.0.0.1#8961	# relay default 10.1.0.53
+resolv-file=/etc/dnsmasq.conf
+no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+
+	ns := readDnsmasqNs(strings.NewReader(buf.String()))
+	expectedNs := []dnsMasqNs{
+		{Server: "10.0.0.53", Port: 53, Provenance: "configuration",
+			RoutingInstance: "shared"},
+		{Server: "192.168.1.53", Port: 53, Provenance: "configuration"},
+		{Server: "10.1.0.53", Port: 53, Provenance: "configuration",
+			RoutingInstance: "default"},
+	}
+	if !reflect.DeepEqual(ns, expectedNs) {
+		t.Log("got", ns)
+		t.Log("expected", expectedNs)
+		t.Fatal("didn't get expected name servers")
+	}
+}
+
+func TestValidateNameserverParametersRelayTLS(t *testing.T) {
+	conf := relayTestConfig()
+	conf.NameserverParameters[0].Transport = "tls"
+	err := conf.validateNameserverParameters()
+	cerr, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatal("expected a ConfigError, got", err)
+	}
+	const path = "name-server-parameters/10.0.0.53/routing-instance"
+	if cerr.Path != path {
+		t.Fatalf("got path %s, expected %s", cerr.Path, path)
+	}
+}
+
+func TestRelayPortsFollowAddress(t *testing.T) {
+	conf := relayTestConfig()
+	before := conf.relayedNameservers("blue")
+	conf.Nameservers = []string{"10.1.0.53", "192.168.1.53", "10.0.0.53"}
+	conf.NameserverParameters = append(conf.NameserverParameters,
+		NameserverParameters{Address: "10.2.0.53", RoutingInstance: "shared"})
+	conf.Nameservers = append(conf.Nameservers, "10.2.0.53")
+	after := conf.relayedNameservers("blue")
+	if len(after) != 3 {
+		t.Fatal("expected 3 relays, got", after)
+	}
+	ports := make(map[string]uint16)
+	for _, ns := range after {
+		if ports[ns.Address] != 0 {
+			t.Fatal("duplicate relay", ns)
+		}
+		ports[ns.Address] = ns.Port
+	}
+	for _, ns := range before {
+		if ports[ns.Address] != ns.Port {
+			t.Fatalf("relay for %s moved from port %d to %d",
+				ns.Address, ns.Port, ports[ns.Address])
+		}
+	}
+}
+
+func TestAssignRelayPortsCollision(t *testing.T) {
+	servers := make([]relayedNameserver, relayPorts)
+	for i := range servers {
+		servers[i] = relayedNameserver{
+			Address:         net.IPv4(10, 0, byte(i/256), byte(i%256)).String(),
+			RoutingInstance: "blue",
+		}
+	}
+	assignRelayPorts(servers)
+	seen := make(map[uint16]bool)
+	for _, ns := range servers {
+		if ns.Port < relayBasePort || ns.Port >= relayBasePort+relayPorts {
+			t.Fatal("port out of range", ns)
+		}
+		if seen[ns.Port] {
+			t.Fatal("port assigned twice", ns)
+		}
+		seen[ns.Port] = true
+	}
+}
+
+func TestMergeRelayState(t *testing.T) {
+	relays := relayTestConfig().relayedNameservers("blue")
+	state := &StateData{}
+	state.State.Nameservers = []NameserverState{
+		{IPAddress: "127.0.0.1", Port: relays[0].Port, QueriesSent: 10,
+			QueriesRetriedOrFailed: 2},
+		{IPAddress: "192.168.1.53", Port: 53, QueriesSent: 4},
+		{IPAddress: "10.0.0.53", Port: 53, RoutingInstance: "shared",
+			Provenance: "configuration", InUse: true},
+	}
+	mergeRelayState(state, relays)
+	expected := []NameserverState{
+		{IPAddress: "192.168.1.53", Port: 53, QueriesSent: 4},
+		{IPAddress: "10.0.0.53", Port: 53, RoutingInstance: "shared",
+			Provenance: "configuration", InUse: true, QueriesSent: 10,
+			QueriesRetriedOrFailed: 2},
+	}
+	if !reflect.DeepEqual(state.State.Nameservers, expected) {
+		t.Log("got", state.State.Nameservers)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected state")
+	}
+}
+
+// startTestUpstream answers every query with itself, over UDP and TCP.
+func startTestUpstream(t *testing.T) (string, func()) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := udp.LocalAddr().String()
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		udp.Close()
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, client, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			udp.WriteTo(buf[:n], client)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return addr, func() {
+		udp.Close()
+		tcp.Close()
+	}
+}
+
+func TestRelay(t *testing.T) {
+	upstream, stop := startTestUpstream(t)
+	defer stop()
+
+	r, err := listenRelay("", "127.0.0.1:0", "", upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.stop()
+	query := []byte("\x12\x34query")
+
+	udp, err := net.Dial("udp", r.udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	udp.SetDeadline(time.Now().Add(testTimeout))
+	_, err = udp.Write(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 512)
+	n, err := udp.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], query) {
+		t.Fatalf("got %q over udp, expected %q", buf[:n], query)
+	}
+
+	tcp, err := net.Dial("tcp", r.tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	tcp.SetDeadline(time.Now().Add(testTimeout))
+	msg := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	msg = append(msg, query...)
+	_, err = tcp.Write(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(msg))
+	_, err = io.ReadFull(tcp, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("got %q over tcp, expected %q", got, msg)
+	}
+}
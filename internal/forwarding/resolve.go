@@ -0,0 +1,79 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+)
+
+const resolveTimeout = 5 * time.Second
+
+type ResolveAnswer struct {
+	Name string `rfc7951:"name"`
+	Type string `rfc7951:"type"`
+	TTL  uint32 `rfc7951:"ttl"`
+	Data string `rfc7951:"data"`
+}
+
+// ResolveResult is the answer to a test query.
+type ResolveResult struct {
+	Rcode   string
+	Answers []ResolveAnswer
+	// Server is the address the query was sent to.
+	Server string
+	// Latency is the round trip time in milliseconds.
+	Latency uint32
+}
+
+type exchangeFunc func(*dnsclient.Message, string) (*dnsclient.Message, time.Duration, error)
+
+func resolveName(exchange exchangeFunc, name, qtype, server string) (*ResolveResult, error) {
+	if qtype == "" {
+		qtype = "A"
+	}
+	t, ok := dnsclient.StringType(qtype)
+	if !ok {
+		return nil, errors.New("unsupported record type " + qtype)
+	}
+	resp, rtt, err := exchange(
+		dnsclient.NewQuery(name, t, dnsclient.ClassINET), server)
+	if err != nil {
+		return nil, err
+	}
+	out := &ResolveResult{
+		Rcode:   dnsclient.RcodeString(resp.Rcode),
+		Server:  server,
+		Latency: uint32(rtt / time.Millisecond),
+	}
+	for _, rr := range resp.Answer {
+		out.Answers = append(out.Answers, ResolveAnswer{
+			Name: rr.Name,
+			Type: dnsclient.TypeString(rr.Type),
+			TTL:  rr.TTL,
+			Data: rr.Data,
+		})
+	}
+	return out, nil
+}
+
+// resolve queries dnsmasq for name, or upstream when it is set. Either
+// is queried from within the routing instance.
+func (c *Config) resolve(name, qtype, upstream string) (*ResolveResult, error) {
+	server := c.localServer()
+	if upstream != "" {
+		if net.ParseIP(upstream) == nil {
+			return nil, errors.New("invalid name server address " + upstream)
+		}
+		server = net.JoinHostPort(upstream, strconv.Itoa(defaultPort))
+	}
+	client := &dnsclient.Client{
+		Timeout: resolveTimeout,
+		Device:  relayDevice(c.instance),
+	}
+	return resolveName(client.Exchange, name, qtype, server)
+}
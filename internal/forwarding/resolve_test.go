@@ -0,0 +1,79 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+)
+
+func TestResolveName(t *testing.T) {
+	var sent *dnsclient.Message
+	var sentTo string
+	exchange := func(
+		query *dnsclient.Message,
+		server string,
+	) (*dnsclient.Message, time.Duration, error) {
+		sent, sentTo = query, server
+		return &dnsclient.Message{
+			ID:       query.ID,
+			Response: true,
+			Rcode:    dnsclient.RcodeSuccess,
+			Answer: []dnsclient.RR{
+				{Name: "www.example.com", Type: dnsclient.TypeCNAME,
+					TTL: 300, Data: "example.com"},
+				{Name: "example.com", Type: dnsclient.TypeAAAA,
+					TTL: 120, Data: "2001:db8::1"},
+			},
+		}, 12 * time.Millisecond, nil
+	}
+	res, err := resolveName(exchange, "www.example.com", "aaaa", "192.0.2.53:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sentTo != "192.0.2.53:53" ||
+		sent.Question[0].Type != dnsclient.TypeAAAA {
+		t.Fatal("unexpected query", sent, sentTo)
+	}
+	expected := &ResolveResult{
+		Rcode: "NOERROR",
+		Answers: []ResolveAnswer{
+			{Name: "www.example.com", Type: "CNAME", TTL: 300,
+				Data: "example.com"},
+			{Name: "example.com", Type: "AAAA", TTL: 120,
+				Data: "2001:db8::1"},
+		},
+		Server:  "192.0.2.53:53",
+		Latency: 12,
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatal("unexpected result", res)
+	}
+}
+
+func TestResolveNameErrors(t *testing.T) {
+	exchange := func(
+		query *dnsclient.Message,
+		server string,
+	) (*dnsclient.Message, time.Duration, error) {
+		return nil, 0, errors.New("timeout")
+	}
+	_, err := resolveName(exchange, "example.com", "BOGUS", "127.0.0.1:53")
+	if err == nil {
+		t.Fatal("unsupported type accepted")
+	}
+	_, err = resolveName(exchange, "example.com", "", "127.0.0.1:53")
+	if err == nil {
+		t.Fatal("exchange error not returned")
+	}
+
+	conf := NewConfig()
+	_, err = conf.resolve("example.com", "A", "not-an-address")
+	if err == nil {
+		t.Fatal("invalid upstream accepted")
+	}
+}
@@ -15,7 +15,7 @@ func RPCNew(config *Config) *RPC {
 }
 
 func (r *RPC) ResetDnsForwarding() (struct{}, error) {
-	err := r.conf.forwardingProcess.Restart()
+	err := r.conf.restart()
 	return struct{}{}, err
 }
 
@@ -23,3 +23,15 @@ func (r *RPC) ResetDnsForwardingCache() (struct{}, error) {
 	err := r.conf.forwardingProcess.Signal(syscall.SIGHUP)
 	return struct{}{}, err
 }
+
+func (r *RPC) LookupDnsForwardingCache(name string) ([]CacheEntry, error) {
+	return r.conf.lookupCache(name)
+}
+
+func (r *RPC) FlushDnsForwardingCache(name string, subdomains bool) (uint32, error) {
+	return r.conf.flushCache(name, subdomains)
+}
+
+func (r *RPC) ResolveDnsName(name, qtype, upstream string) (*ResolveResult, error) {
+	return r.conf.resolve(name, qtype, upstream)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const defaultPort = 53
+
+// serverAddress formats a name server the way dnsmasq expects it, the
+// port is only given when it isn't the default.
+func serverAddress(addr string, port uint16) string {
+	if port == 0 || port == defaultPort {
+		return addr
+	}
+	return addr + "#" + strconv.Itoa(int(port))
+}
+
+// overrideServer formats a server of a domain override, including the
+// interface and address the queries are sent from.
+func overrideServer(addr string, override DomainOverride) string {
+	out := serverAddress(addr, override.Port)
+	if override.SourceInterface != "" {
+		out += "@" + override.SourceInterface
+	}
+	if override.SourceAddress != "" {
+		out += "@" + override.SourceAddress
+	}
+	return out
+}
+
+// validateDomainOverrides checks what dnsmasq only notices when it
+// fails to send a query.
+func (c *ConfigData) validateDomainOverrides() error {
+	for _, override := range c.DomainOverrides {
+		path := "domain/" + override.Domain
+		if override.LocalOnly {
+			if len(override.Servers) > 0 {
+				return &ConfigError{
+					Path:    path + "/local-only",
+					Message: "local-only domains cannot have servers",
+				}
+			}
+			continue
+		}
+		if len(override.Servers) == 0 {
+			return &ConfigError{
+				Path:    path,
+				Message: "a server or local-only must be configured",
+			}
+		}
+		if override.SourceAddress == "" {
+			continue
+		}
+		src := net.ParseIP(override.SourceAddress)
+		for _, server := range override.Servers {
+			ip := net.ParseIP(server)
+			if ip == nil || src == nil || (ip.To4() == nil) != (src.To4() == nil) {
+				return &ConfigError{
+					Path: path + "/source-address",
+					Message: "source address " + override.SourceAddress +
+						" cannot reach server " + server,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// splitServerAddress splits the address#port form dnsmasq uses for
+// name servers in its configuration, its log and its statistics. IPv6
+// addresses may be enclosed in brackets and anything following an @,
+// the source of the queries, is ignored. port is empty if absent.
+func splitServerAddress(in string) (addr, port string, err error) {
+	s := in
+	if i := strings.IndexByte(s, '@'); i >= 0 {
+		s = s[:i]
+	}
+	addr = s
+	if i := strings.LastIndexByte(s, '#'); i >= 0 {
+		addr, port = s[:i], s[i+1:]
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	ip := addr
+	if i := strings.IndexByte(ip, '%'); i >= 0 {
+		ip = ip[:i]
+	}
+	if net.ParseIP(ip) == nil {
+		return "", "", errors.New("invalid name server address: " + in)
+	}
+	return addr, port, nil
+}
+
+func parseServerAddress(in string) (string, uint16, error) {
+	addr, port, err := splitServerAddress(in)
+	if err != nil {
+		return "", 0, err
+	}
+	if port == "" {
+		return addr, defaultPort, nil
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	return addr, uint16(p), nil
+}
+
+// nameserverKey identifies a name server by address and port.
+func nameserverKey(addr string, port uint16) string {
+	return addr + "#" + strconv.Itoa(int(port))
+}
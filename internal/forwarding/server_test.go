@@ -0,0 +1,117 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import "testing"
+
+func TestSplitServerAddress(t *testing.T) {
+	tests := []struct {
+		in   string
+		addr string
+		port string
+		err  bool
+	}{
+		{in: "10.0.0.1", addr: "10.0.0.1"},
+		{in: "10.0.0.1#5353", addr: "10.0.0.1", port: "5353"},
+		{in: "2001:db8::1", addr: "2001:db8::1"},
+		{in: "2001:db8::1#53", addr: "2001:db8::1", port: "53"},
+		{in: "[2001:db8::1]#853", addr: "2001:db8::1", port: "853"},
+		{in: "fe80::1%eth0#53", addr: "fe80::1%eth0", port: "53"},
+		{in: "10.0.0.1#53@eth0", addr: "10.0.0.1", port: "53"},
+		{in: "10.0.0.1#baz#53", err: true},
+		{in: "example.com", err: true},
+		{in: "", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			addr, port, err := splitServerAddress(test.in)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error, got", addr, port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr != test.addr || port != test.port {
+				t.Fatalf("got %q %q, expected %q %q",
+					addr, port, test.addr, test.port)
+			}
+		})
+	}
+}
+
+func TestServerAddress(t *testing.T) {
+	if got := serverAddress("2001:db8::1", 53); got != "2001:db8::1" {
+		t.Fatal("unexpected default port rendering:", got)
+	}
+	if got := serverAddress("2001:db8::1", 5353); got != "2001:db8::1#5353" {
+		t.Fatal("unexpected port rendering:", got)
+	}
+}
+
+func TestValidateDomainOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		override DomainOverride
+		path     string
+	}{
+		{
+			name: "valid",
+			override: DomainOverride{
+				Domain:        "att.com",
+				Servers:       []string{"10.0.0.53"},
+				SourceAddress: "10.0.0.1",
+			},
+		},
+		{
+			name:     "local-only",
+			override: DomainOverride{Domain: "att.com", LocalOnly: true},
+		},
+		{
+			name: "local-only-with-servers",
+			override: DomainOverride{
+				Domain:    "att.com",
+				Servers:   []string{"10.0.0.53"},
+				LocalOnly: true,
+			},
+			path: "domain/att.com/local-only",
+		},
+		{
+			name:     "no-servers",
+			override: DomainOverride{Domain: "att.com"},
+			path:     "domain/att.com",
+		},
+		{
+			name: "source-family-mismatch",
+			override: DomainOverride{
+				Domain:        "att.com",
+				Servers:       []string{"10.0.0.53", "2001:db8::53"},
+				SourceAddress: "10.0.0.1",
+			},
+			path: "domain/att.com/source-address",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := &ConfigData{
+				DomainOverrides: []DomainOverride{test.override},
+			}
+			err := conf.validateDomainOverrides()
+			if test.path == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			cerr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatal("expected a ConfigError, got", err)
+			}
+			if cerr.Path != test.path {
+				t.Fatalf("got path %s, expected %s", cerr.Path, test.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/danos/vyatta-service-dns/internal/log"
+	"github.com/danos/vyatta-service-dns/internal/process"
+)
+
+// Router advertisement options carrying DNS configuration (RFC 8106).
+const (
+	ndOptRDNSS = 25
+	ndOptDNSSL = 31
+
+	icmpv6RouterAdvertisement = 134
+
+	// struct nduseroptmsg
+	ndUserOptMsgLen = 16
+)
+
+type raEntry struct {
+	Value    string
+	Lifetime time.Duration
+}
+
+// raDNSInfo is the DNS configuration of a single router advertisement.
+type raDNSInfo struct {
+	Ifindex int
+	Servers []raEntry
+	Domains []raEntry
+}
+
+// parseNDUserOpt decodes the payload of an RTM_NEWNDUSEROPT message,
+// the kernel hands the ND options it doesn't handle itself to user
+// space this way.
+func parseNDUserOpt(data []byte) (raDNSInfo, error) {
+	var info raDNSInfo
+	if len(data) < ndUserOptMsgLen {
+		return info, errors.New("short nduseropt message")
+	}
+	if data[0] != syscall.AF_INET6 {
+		return info, errors.New("nduseropt message is not for IPv6")
+	}
+	optsLen := int(*(*uint16)(unsafe.Pointer(&data[2])))
+	info.Ifindex = int(*(*int32)(unsafe.Pointer(&data[4])))
+	if data[8] != icmpv6RouterAdvertisement {
+		return info, fmt.Errorf("unexpected ICMPv6 type %d", data[8])
+	}
+	if ndUserOptMsgLen+optsLen > len(data) {
+		return info, errors.New("truncated nduseropt message")
+	}
+
+	opts := data[ndUserOptMsgLen : ndUserOptMsgLen+optsLen]
+	for len(opts) >= 2 {
+		optLen := int(opts[1]) * 8
+		if optLen == 0 || optLen > len(opts) {
+			return info, errors.New("invalid ND option length")
+		}
+		opt := opts[:optLen]
+		opts = opts[optLen:]
+		if optLen < 8 {
+			continue
+		}
+		lifetime := time.Duration(binary.BigEndian.Uint32(opt[4:8])) *
+			time.Second
+		switch opt[0] {
+		case ndOptRDNSS:
+			for addrs := opt[8:]; len(addrs) >= net.IPv6len; addrs = addrs[net.IPv6len:] {
+				ip := net.IP(append([]byte(nil), addrs[:net.IPv6len]...))
+				info.Servers = append(info.Servers,
+					raEntry{Value: ip.String(), Lifetime: lifetime})
+			}
+		case ndOptDNSSL:
+			for _, domain := range readDNSSLDomains(opt[8:]) {
+				info.Domains = append(info.Domains,
+					raEntry{Value: domain, Lifetime: lifetime})
+			}
+		}
+	}
+	return info, nil
+}
+
+// readDNSSLDomains decodes the uncompressed domain names of a DNSSL
+// option, the option is padded with zeros.
+func readDNSSLDomains(b []byte) []string {
+	var out []string
+	var labels []string
+	for len(b) > 0 {
+		l := int(b[0])
+		b = b[1:]
+		if l == 0 {
+			if len(labels) > 0 {
+				out = append(out, strings.ToLower(strings.Join(labels, ".")))
+				labels = nil
+			}
+			continue
+		}
+		if l > len(b) {
+			break
+		}
+		labels = append(labels, string(b[:l]))
+		b = b[l:]
+	}
+	return out
+}
+
+// listenNDUserOpts passes the DNS configuration of every router
+// advertisement received on the system to handler until the returned
+// listener is closed.
+func listenNDUserOpts(handler func(raDNSInfo)) (io.Closer, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: 1 << (syscall.RTNLGRP_ND_USEROPT - 1),
+	})
+	if err == nil {
+		// Hand the socket to the runtime poller so that closing it
+		// ends the pending read.
+		err = syscall.SetNonblock(fd, true)
+	}
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "nduseropt")
+
+	go func() {
+		buf := make([]byte, os.Getpagesize())
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				if !errors.Is(err, os.ErrClosed) {
+					log.Elog.Println("slaac-listener:", err)
+				}
+				return
+			}
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				log.Dlog.Println("slaac-listener:", err)
+				continue
+			}
+			for _, msg := range msgs {
+				if msg.Header.Type != syscall.RTM_NEWNDUSEROPT {
+					continue
+				}
+				info, err := parseNDUserOpt(msg.Data)
+				if err != nil {
+					log.Dlog.Println("slaac-listener:", err)
+					continue
+				}
+				if len(info.Servers) == 0 && len(info.Domains) == 0 {
+					continue
+				}
+				handler(info)
+			}
+		}
+	}()
+	return f, nil
+}
+
+// slaacLearned holds the expiry time of everything learned on an
+// interface.
+type slaacLearned struct {
+	servers map[string]time.Time
+	domains map[string]time.Time
+}
+
+// slaacConfig learns name servers and search domains from the router
+// advertisements received on the configured interfaces. Routers
+// repeat their advertisements, entries are dropped once their
+// lifetime runs out without being refreshed.
+type slaacConfig struct {
+	mu          sync.Mutex
+	proc        process.Process
+	confFileFmt string
+	notify      func()
+	listen      func(func(raDNSInfo)) (io.Closer, error)
+	ifName      func(int) (string, error)
+	now         func() time.Time
+
+	interfaces map[string]*slaacLearned
+	listener   io.Closer
+	timer      *time.Timer
+}
+
+func newSLAACConfig(
+	proc process.Process,
+	confFileFmt string,
+	notify func(),
+) *slaacConfig {
+	return &slaacConfig{
+		proc:        proc,
+		confFileFmt: confFileFmt,
+		notify:      notify,
+		listen:      listenNDUserOpts,
+		ifName: func(ifindex int) (string, error) {
+			intf, err := net.InterfaceByIndex(ifindex)
+			if err != nil {
+				return "", err
+			}
+			return intf.Name, nil
+		},
+		now:        time.Now,
+		interfaces: make(map[string]*slaacLearned),
+	}
+}
+
+func (c *slaacConfig) Set(interfaces []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keep := make(map[string]struct{})
+	for _, intf := range interfaces {
+		keep[intf] = struct{}{}
+		if _, ok := c.interfaces[intf]; !ok {
+			c.interfaces[intf] = &slaacLearned{
+				servers: make(map[string]time.Time),
+				domains: make(map[string]time.Time),
+			}
+		}
+	}
+	for intf := range c.interfaces {
+		if _, ok := keep[intf]; ok {
+			continue
+		}
+		delete(c.interfaces, intf)
+		err := os.Remove(fmt.Sprintf(c.confFileFmt, intf))
+		if err != nil && !os.IsNotExist(err) {
+			log.Dlog.Println("slaac-config:", err)
+		}
+	}
+	c.schedule()
+
+	if len(c.interfaces) == 0 {
+		if c.listener != nil {
+			c.listener.Close()
+			c.listener = nil
+		}
+		return nil
+	}
+	if c.listener != nil {
+		return nil
+	}
+	// Name servers are learned from the next advertisement, routers
+	// send them unsolicited at least every 30 minutes.
+	listener, err := c.listen(c.handle)
+	if err != nil {
+		return err
+	}
+	c.listener = listener
+	return nil
+}
+
+func (c *slaacConfig) handle(info raDNSInfo) {
+	name, err := c.ifName(info.Ifindex)
+	if err != nil {
+		log.Dlog.Println("slaac-config:", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	learned, ok := c.interfaces[name]
+	if !ok {
+		return
+	}
+	now := c.now()
+	update := func(entries map[string]time.Time, in []raEntry) {
+		for _, e := range in {
+			if e.Lifetime == 0 {
+				delete(entries, e.Value)
+				continue
+			}
+			entries[e.Value] = now.Add(e.Lifetime)
+		}
+	}
+	update(learned.servers, info.Servers)
+	update(learned.domains, info.Domains)
+	c.apply(name)
+	c.schedule()
+}
+
+// expire drops the entries whose lifetime has run out.
+func (c *slaacConfig) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for name, learned := range c.interfaces {
+		var expired bool
+		for _, entries := range []map[string]time.Time{
+			learned.servers, learned.domains,
+		} {
+			for value, expiry := range entries {
+				if expiry.After(now) {
+					continue
+				}
+				delete(entries, value)
+				expired = true
+			}
+		}
+		if expired {
+			c.apply(name)
+		}
+	}
+	c.schedule()
+}
+
+func (c *slaacConfig) schedule() {
+	var next time.Time
+	for _, learned := range c.interfaces {
+		for _, entries := range []map[string]time.Time{
+			learned.servers, learned.domains,
+		} {
+			for _, expiry := range entries {
+				if next.IsZero() || expiry.Before(next) {
+					next = expiry
+				}
+			}
+		}
+	}
+	if next.IsZero() {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		return
+	}
+	d := next.Sub(c.now())
+	if c.timer == nil {
+		c.timer = time.AfterFunc(d, c.expire)
+		return
+	}
+	c.timer.Stop()
+	c.timer.Reset(d)
+}
+
+func sortedKeys(m map[string]time.Time) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// apply renders what was learned on intf, dnsmasq is only restarted
+// when that changes the name servers it uses.
+func (c *slaacConfig) apply(intf string) {
+	learned := c.interfaces[intf]
+	var buf bytes.Buffer
+	err := writeDnsmasqIPv6Config(&buf, "slaac", intf, dhcpv6Lease{
+		Nameservers: sortedKeys(learned.servers),
+		Domains:     sortedKeys(learned.domains),
+	})
+	if err != nil {
+		log.Dlog.Println("slaac-config:", err)
+		return
+	}
+	changed, err := writeFileIfChanged(
+		fmt.Sprintf(c.confFileFmt, intf), buf.Bytes())
+	if err != nil {
+		log.Dlog.Println("slaac-config:", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	err = c.proc.Restart()
+	if err != nil {
+		log.Dlog.Println("slaac-config:", err)
+		return
+	}
+	if c.notify != nil {
+		c.notify()
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func ndUserOptMsg(ifindex int, opts ...[]byte) []byte {
+	var body []byte
+	for _, opt := range opts {
+		body = append(body, opt...)
+	}
+	msg := make([]byte, ndUserOptMsgLen, ndUserOptMsgLen+len(body))
+	msg[0] = syscall.AF_INET6
+	*(*uint16)(unsafe.Pointer(&msg[2])) = uint16(len(body))
+	*(*int32)(unsafe.Pointer(&msg[4])) = int32(ifindex)
+	msg[8] = icmpv6RouterAdvertisement
+	return append(msg, body...)
+}
+
+func rdnssOpt(lifetime uint32, addrs ...string) []byte {
+	opt := make([]byte, 8)
+	opt[0] = ndOptRDNSS
+	opt[1] = byte(1 + 2*len(addrs))
+	binary.BigEndian.PutUint32(opt[4:], lifetime)
+	for _, addr := range addrs {
+		opt = append(opt, net.ParseIP(addr).To16()...)
+	}
+	return opt
+}
+
+func dnsslOpt(lifetime uint32, domains ...[]byte) []byte {
+	opt := make([]byte, 8)
+	opt[0] = ndOptDNSSL
+	binary.BigEndian.PutUint32(opt[4:], lifetime)
+	for _, d := range domains {
+		opt = append(opt, d...)
+	}
+	for len(opt)%8 != 0 {
+		opt = append(opt, 0)
+	}
+	opt[1] = byte(len(opt) / 8)
+	return opt
+}
+
+func TestParseNDUserOpt(t *testing.T) {
+	msg := ndUserOptMsg(3,
+		rdnssOpt(1800, "2001:db8::53", "fe80::1"),
+		dnsslOpt(600,
+			[]byte("\x03lab\x03att\x03com\x00"),
+			[]byte("\x03ATT\x03com\x00")))
+	expected := raDNSInfo{
+		Ifindex: 3,
+		Servers: []raEntry{
+			{Value: "2001:db8::53", Lifetime: 1800 * time.Second},
+			{Value: "fe80::1", Lifetime: 1800 * time.Second},
+		},
+		Domains: []raEntry{
+			{Value: "lab.att.com", Lifetime: 600 * time.Second},
+			{Value: "att.com", Lifetime: 600 * time.Second},
+		},
+	}
+	info, err := parseNDUserOpt(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Log("got", info)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected options")
+	}
+}
+
+func TestParseNDUserOptInvalid(t *testing.T) {
+	bad := rdnssOpt(1800, "2001:db8::53")
+	bad[1] = 0
+	tests := map[string][]byte{
+		"short":          make([]byte, 4),
+		"zero-length":    ndUserOptMsg(3, bad),
+		"truncated-opts": ndUserOptMsg(3, rdnssOpt(1800, "2001:db8::53"))[:24],
+	}
+	for name, msg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseNDUserOpt(msg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func TestSLAACConfigLearnsAndExpires(t *testing.T) {
+	err := os.MkdirAll("tmp", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("tmp")
+
+	proc := newTproc("tmp/dnsmasq.conf", "tmp/dnsmasq.log")
+	c := newSLAACConfig(proc, "tmp/slaacinterface-%s.conf", nil)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	c.ifName = func(ifindex int) (string, error) {
+		if ifindex != 3 {
+			return "", errors.New("no such interface")
+		}
+		return "eth0", nil
+	}
+	c.listen = func(func(raDNSInfo)) (io.Closer, error) {
+		return nopCloser{}, nil
+	}
+	err = c.Set([]string{"eth0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Set(nil)
+
+	expectRestart := func(expected bool) {
+		t.Helper()
+		select {
+		case act := <-proc.actions:
+			if !expected {
+				t.Fatalf("no action expected, got %s", act)
+			}
+			if act != "Restart" {
+				t.Fatalf("Restart expected, got %s", act)
+			}
+		default:
+			if expected {
+				t.Fatal("expected a Restart")
+			}
+		}
+	}
+
+	ra := raDNSInfo{
+		Ifindex: 3,
+		Servers: []raEntry{
+			{Value: "2001:db8::53", Lifetime: 1800 * time.Second},
+		},
+		Domains: []raEntry{
+			{Value: "lab.att.com", Lifetime: 600 * time.Second},
+		},
+	}
+	c.handle(ra)
+	expectRestart(true)
+	const expected = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost.
+server=2001:db8::53	# slaac eth0
+server=/lab.att.com/2001:db8::53	# slaac eth0
+`
+	got, err := ioutil.ReadFile("tmp/slaacinterface-eth0.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Log("got", string(got))
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+
+	// Periodic advertisements only refresh the lifetimes.
+	now = now.Add(300 * time.Second)
+	c.handle(ra)
+	expectRestart(false)
+
+	// Advertisements on other interfaces are ignored.
+	c.handle(raDNSInfo{Ifindex: 4, Servers: ra.Servers})
+	expectRestart(false)
+
+	// The search domain runs out first.
+	now = now.Add(601 * time.Second)
+	c.expire()
+	expectRestart(true)
+	const expectedExpired = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost.
+server=2001:db8::53	# slaac eth0
+`
+	got, err = ioutil.ReadFile("tmp/slaacinterface-eth0.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expectedExpired {
+		t.Log("got", string(got))
+		t.Log("expected", expectedExpired)
+		t.Fatal("didn't get expected output")
+	}
+
+	// A zero lifetime withdraws the name server.
+	c.handle(raDNSInfo{
+		Ifindex: 3,
+		Servers: []raEntry{{Value: "2001:db8::53"}},
+	})
+	expectRestart(true)
+	got, err = ioutil.ReadFile("tmp/slaacinterface-eth0.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatal("unexpected output", string(got))
+	}
+}
+
+func TestReadDnsmasqNsSLAACProvenance(t *testing.T) {
+	const conf = `
+server=fe80::1%eth0	# slaac eth0
+server=/lab.att.com/fe80::1%eth0	# slaac eth0
+`
+	expected := []dnsMasqNs{
+		{
+			Server:     "fe80::1",
+			Port:       53,
+			Provenance: "slaac",
+		},
+		{
+			Server:     "fe80::1",
+			Port:       53,
+			Domain:     "lab.att.com",
+			Provenance: "slaac",
+		},
+	}
+	ns := readDnsmasqNs(strings.NewReader(conf))
+	if !reflect.DeepEqual(ns, expected) {
+		t.Log("got", ns)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected name servers")
+	}
+}
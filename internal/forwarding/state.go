@@ -17,6 +17,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
 	"github.com/danos/vyatta-service-dns/internal/log"
 	"github.com/danos/vyatta-service-dns/internal/process"
 	"github.com/fsnotify/fsnotify"
@@ -27,12 +28,22 @@ type StateData struct {
 	State struct {
 		QueriesForwarded uint64 `rfc7951:"queries-forwarded"`
 		QueriesAnswered  uint64 `rfc7951:"queries-answered"`
+		ForwardingPolicy string `rfc7951:"forwarding-policy,omitempty"`
 		Cache            struct {
 			Size          uint32 `rfc7951:"size"`
 			Entries       uint64 `rfc7951:"cache-entries"`
 			ReusedEntries uint64 `rfc7951:"reused-cache-entries"`
+			// EntriesRestored counts the names put back into the
+			// cache after dnsmasq was restarted.
+			EntriesRestored uint64 `rfc7951:"entries-restored,omitempty"`
 		} `rfc7951:"cache,omitempty"`
 		Nameservers []NameserverState `rfc7951:"nameservers,omitempty"`
+		DNSSEC      *DNSSECState      `rfc7951:"dnssec,omitempty"`
+		Blocklists  []BlocklistState  `rfc7951:"blocklists,omitempty"`
+
+		TopClients       []TopClientState `rfc7951:"top-clients,omitempty"`
+		TopNames         []TopNameState   `rfc7951:"top-names,omitempty"`
+		TopNXDomainNames []TopNameState   `rfc7951:"top-nxdomain-names,omitempty"`
 	} `rfc7951:"state,omitempty"`
 }
 
@@ -45,23 +56,57 @@ type NameserverState struct {
 	InUse                  bool     `rfc7951:"in-use"`
 	DomainOverrideOnly     bool     `rfc7951:"domain-override-only"`
 	Domains                []string `rfc7951:"domains,omitempty"`
+	Transport              string   `rfc7951:"transport,omitempty"`
+	TLSProxyStatus         string   `rfc7951:"tls-proxy-status,omitempty"`
+	RoutingInstance        string   `rfc7951:"routing-instance,omitempty"`
+	Status                 string   `rfc7951:"status,omitempty"`
+	RoundTripTime          uint32   `rfc7951:"round-trip-time,omitempty"`
+	LastSuccess            string   `rfc7951:"last-success,omitempty"`
 }
 
 type State struct {
-	mu         sync.Mutex
-	state      atomic.Value
-	p          process.Process
-	statefile  string
-	resolvfile string
-	conffile   string
+	mu          sync.Mutex
+	state       atomic.Value
+	p           process.Process
+	statefile   string
+	resolvfile  string
+	conffile    string
+	statsServer string
+	statsDevice string
+	dnssec      *dnssecStats
+	blocklists  *blocklistStats
+	tlsProxy    bool
+	relays      []relayedNameserver
+	health      *healthChecker
+	policy      string
+	cacheWarmer *cacheWarmer
+	topTalkers  *topTalkers
+	// followedLog returns the statistics read by the log tail, the
+	// log must not be truncated while it is followed.
+	followedLog func() ([]byte, bool, error)
 }
 
 func NewState(config *Config) *State {
 	s := &State{
-		p:          config.forwardingProcess,
-		statefile:  config.statefile,
-		resolvfile: config.resolvfile,
-		conffile:   config.conffile,
+		p:           config.forwardingProcess,
+		statefile:   config.statefile,
+		resolvfile:  config.resolvfile,
+		conffile:    config.conffile,
+		statsServer: config.statsserver,
+		dnssec:      config.getDNSSECStats(),
+		blocklists:  config.blocklistConfig.getStats(),
+		health:      config.health,
+		cacheWarmer: config.getCacheWarmer(),
+		topTalkers:  config.getTopTalkers(),
+		followedLog: config.dumpStateLog,
+	}
+	if config.instance != "default" {
+		s.statsDevice = vrfDevice(config.instance)
+	}
+	if conf := config.Get(); conf != nil {
+		s.tlsProxy = len(conf.tlsNameservers()) > 0
+		s.relays = conf.relayedNameservers(config.instance)
+		s.policy = conf.forwardingPolicy()
 	}
 	s.state.Store(&StateData{})
 	return s
@@ -69,6 +114,93 @@ func NewState(config *Config) *State {
 
 func (s *State) Get() *StateData {
 	const logPrefix = "forwarding-state-get:"
+	var state *StateData
+	if s.statsServer != "" {
+		var err error
+		state, err = s.queryState()
+		if err != nil {
+			log.Dlog.Println(logPrefix,
+				"statistics query failed, reading log:", err)
+		}
+	}
+	if state == nil {
+		state = s.readLogState()
+	}
+	// The collected state is kept for the next Get, merge into a copy.
+	state = state.clone()
+	if s.dnssec != nil {
+		state.State.DNSSEC = s.dnssec.get()
+	}
+	state.State.Blocklists = s.blocklists.get()
+	if s.tlsProxy {
+		mergeTLSProxyState(state, probeTLSProxy(s.statsDevice))
+	}
+	if len(s.relays) > 0 {
+		mergeRelayState(state, s.relays)
+	}
+	if s.health != nil {
+		mergeHealthState(state, s.health.get())
+	}
+	state.State.ForwardingPolicy = s.policy
+	state.State.Cache.EntriesRestored = s.cacheWarmer.entriesRestored()
+	state.State.TopClients, state.State.TopNames,
+		state.State.TopNXDomainNames = s.topTalkers.get()
+	return state
+}
+
+// clone copies the state so that it can be merged into.
+func (s *StateData) clone() *StateData {
+	out := *s
+	out.State.Nameservers = append([]NameserverState(nil),
+		s.State.Nameservers...)
+	return &out
+}
+
+func (s *State) queryState() (*StateData, error) {
+	client := &dnsclient.Client{
+		Timeout: 500 * time.Millisecond,
+		Device:  s.statsDevice,
+	}
+	state, err := queryStateData(func(name string) ([]string, error) {
+		return queryChaosTXT(client, s.statsServer, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resolvFile, err := os.Open(s.resolvfile)
+	if err != nil {
+		log.Dlog.Println("forwarding-state-query:", err)
+	}
+	defer resolvFile.Close()
+
+	dnsmasqFile, err := os.Open(s.conffile)
+	if err != nil {
+		log.Dlog.Println("forwarding-state-query:", err)
+	}
+	defer dnsmasqFile.Close()
+
+	reader := &stateReader{
+		resolvConfReader:  resolvFile,
+		dnsmasqConfReader: dnsmasqFile,
+	}
+	reader.ReadProvenance(state)
+	s.state.Store(state)
+	return state, nil
+}
+
+func (s *State) readLogState() *StateData {
+	const logPrefix = "forwarding-state-get:"
+	if s.followedLog != nil {
+		data, followed, err := s.followedLog()
+		if followed {
+			if err != nil {
+				log.Dlog.Println(logPrefix, err)
+				return s.state.Load().(*StateData)
+			}
+			return s.readState(bytes.NewReader(data))
+		}
+	}
 	// Only one Get at a time can happen since we have to destroy the old file.
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -90,7 +222,12 @@ func (s *State) Get() *StateData {
 		return s.state.Load().(*StateData)
 	}
 	defer stateFile.Close()
+	return s.readState(stateFile)
+}
 
+// readState reads the statistics dnsmasq logged from stateLog.
+func (s *State) readState(stateLog io.Reader) *StateData {
+	const logPrefix = "forwarding-state-get:"
 	resolvFile, err := os.Open(s.resolvfile)
 	if err != nil {
 		log.Dlog.Println(logPrefix, err)
@@ -104,7 +241,7 @@ func (s *State) Get() *StateData {
 	defer dnsmasqFile.Close()
 
 	reader := &stateReader{
-		dnsmasqStateReader: stateFile,
+		dnsmasqStateReader: stateLog,
 		resolvConfReader:   resolvFile,
 		dnsmasqConfReader:  dnsmasqFile,
 	}
@@ -113,6 +250,88 @@ func (s *State) Get() *StateData {
 	return state
 }
 
+// While the log is followed the statistics dnsmasq logs on SIGUSR1
+// are taken from the log tail. They are logged in one go, before the
+// cache when dnsmasq logs queries.
+const (
+	stateDumpTimeout = 1 * time.Second
+	stateDumpIdle    = 200 * time.Millisecond
+)
+
+var stateDumpExp = regexp.MustCompile(`: (time \d+|cache size |` +
+	`queries forwarded |queries for authoritative |server \S+: queries sent )`)
+
+// stateDump collects the statistics lines of the dump.
+type stateDump struct {
+	mu      sync.Mutex
+	lines   bytes.Buffer
+	logged  chan struct{}
+	timeout time.Duration
+	idle    time.Duration
+}
+
+func newStateDump() *stateDump {
+	return &stateDump{
+		logged:  make(chan struct{}, 1),
+		timeout: stateDumpTimeout,
+		idle:    stateDumpIdle,
+	}
+}
+
+func (d *stateDump) readLine(line string) {
+	if d == nil || !stateDumpExp.MatchString(line) {
+		return
+	}
+	d.mu.Lock()
+	d.lines.WriteString(line)
+	d.lines.WriteByte('\n')
+	d.mu.Unlock()
+	select {
+	case d.logged <- struct{}{}:
+	default:
+	}
+}
+
+func (d *stateDump) wait() ([]byte, error) {
+	select {
+	case <-d.logged:
+	case <-time.After(d.timeout):
+		return nil, errors.New("timed out waiting for the statistics")
+	}
+	for {
+		select {
+		case <-d.logged:
+		case <-time.After(d.idle):
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return append([]byte(nil), d.lines.Bytes()...), nil
+		}
+	}
+}
+
+func (c *Config) getStateDump() *stateDump {
+	return c.stateDump.Load().(*stateDump)
+}
+
+// dumpStateLog has dnsmasq log its statistics and returns them when
+// the log is followed, followed is false otherwise.
+func (c *Config) dumpStateLog() (data []byte, followed bool, err error) {
+	if conf := c.Get(); conf == nil || !conf.logQueries() {
+		return nil, false, nil
+	}
+	c.stateDumpMu.Lock()
+	defer c.stateDumpMu.Unlock()
+	d := newStateDump()
+	c.stateDump.Store(d)
+	defer c.stateDump.Store((*stateDump)(nil))
+	err = c.forwardingProcess.Signal(syscall.SIGUSR1)
+	if err != nil {
+		return nil, true, err
+	}
+	data, err = d.wait()
+	return data, true, err
+}
+
 func (s *State) requestState() {
 	const logPrefix = "forwarding state requester:"
 	err := s.p.Signal(syscall.SIGUSR1)
@@ -199,7 +418,7 @@ func (s *stateReader) ReadProvenance(state *StateData) {
 	// This may not be entirely correct but replicates the legacy behavior.
 	for _, n := range resolvNs {
 		resolvNsM[n] = struct{}{}
-		ns[n] = &NameserverState{
+		ns[nameserverKey(n, defaultPort)] = &NameserverState{
 			IPAddress:  n,
 			Port:       53,
 			Provenance: "system",
@@ -213,7 +432,7 @@ func (s *stateReader) ReadProvenance(state *StateData) {
 		if !ok {
 			continue
 		}
-		ns[n] = &NameserverState{
+		ns[nameserverKey(n, defaultPort)] = &NameserverState{
 			IPAddress:  n,
 			Port:       53,
 			Provenance: "dhcp",
@@ -227,7 +446,7 @@ func (s *stateReader) ReadProvenance(state *StateData) {
 		if !ok {
 			continue
 		}
-		ns[n] = &NameserverState{
+		ns[nameserverKey(n, defaultPort)] = &NameserverState{
 			IPAddress:  n,
 			Port:       53,
 			Provenance: "ppp",
@@ -237,9 +456,12 @@ func (s *stateReader) ReadProvenance(state *StateData) {
 
 	// Adjust the list for the dnsmasq configuration file
 	for _, n := range dnsmasqNs {
-		s, ok := ns[n.Server]
+		key := nameserverKey(n.Server, n.Port)
+		s, ok := ns[key]
 		if ok {
-			s.Provenance = "configuration"
+			s.Transport = n.Transport
+			s.RoutingInstance = n.RoutingInstance
+			s.Provenance = n.Provenance
 			s.InUse = true
 			if n.Domain != "" {
 				s.Domains = append(s.Domains, n.Domain)
@@ -249,25 +471,28 @@ func (s *stateReader) ReadProvenance(state *StateData) {
 		} else {
 			s := &NameserverState{
 				IPAddress:          n.Server,
-				Port:               53,
-				Provenance:         "configuration",
+				Port:               n.Port,
+				Provenance:         n.Provenance,
 				InUse:              true,
 				DomainOverrideOnly: true,
+				Transport:          n.Transport,
+				RoutingInstance:    n.RoutingInstance,
 			}
 			if n.Domain != "" {
 				s.Domains = []string{n.Domain}
 			} else {
 				s.DomainOverrideOnly = false
 			}
-			ns[n.Server] = s
+			ns[key] = s
 		}
 	}
 
 	// Update the list of servers discovered by the state file
 	seen := make(map[string]struct{})
 	for i, v := range state.State.Nameservers {
-		seen[v.IPAddress] = struct{}{}
-		s, ok := ns[v.IPAddress]
+		key := nameserverKey(v.IPAddress, v.Port)
+		seen[key] = struct{}{}
+		s, ok := ns[key]
 		if !ok {
 			continue
 		}
@@ -275,6 +500,8 @@ func (s *stateReader) ReadProvenance(state *StateData) {
 		v.Domains = s.Domains
 		v.InUse = s.InUse
 		v.DomainOverrideOnly = s.DomainOverrideOnly
+		v.Transport = s.Transport
+		v.RoutingInstance = s.RoutingInstance
 		state.State.Nameservers[i] = v
 	}
 
@@ -315,6 +542,109 @@ func readStateData(r io.Reader) *StateData {
 	return state
 }
 
+// queryStateData builds the statistics from the CHAOS class TXT
+// records served by dnsmasq, txt performs the lookup of one name.
+func queryStateData(txt func(string) ([]string, error)) (*StateData, error) {
+	state := &StateData{}
+	counter := func(name string, bitSize int) (uint64, error) {
+		vals, err := txt(name)
+		if err != nil {
+			return 0, err
+		}
+		if len(vals) != 1 {
+			return 0, errors.New(name + ": unexpected answer")
+		}
+		return strconv.ParseUint(vals[0], 10, bitSize)
+	}
+
+	size, err := counter("cachesize.bind", 32)
+	if err != nil {
+		return nil, err
+	}
+	state.State.Cache.Size = uint32(size)
+
+	counters := []struct {
+		name string
+		val  *uint64
+	}{
+		{"insertions.bind", &state.State.Cache.Entries},
+		{"evictions.bind", &state.State.Cache.ReusedEntries},
+		{"hits.bind", &state.State.QueriesAnswered},
+		{"misses.bind", &state.State.QueriesForwarded},
+	}
+	for _, c := range counters {
+		*c.val, err = counter(c.name, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	servers, err := txt("servers.bind")
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		ns, err := parseServerStats(server)
+		if err != nil {
+			log.Dlog.Println("query-nameserver-stats:", err)
+			continue
+		}
+		state.State.Nameservers = append(state.State.Nameservers, ns)
+	}
+	return state, nil
+}
+
+// parseServerStats parses a servers.bind string of the form
+// "address#port queries-sent retried-or-failed".
+func parseServerStats(in string) (NameserverState, error) {
+	fields := strings.Fields(in)
+	if len(fields) != 3 {
+		return NameserverState{},
+			errors.New("invalid servers.bind entry: " + in)
+	}
+	addr, port, err := parseServerAddress(fields[0])
+	if err != nil {
+		return NameserverState{}, err
+	}
+	sent, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return NameserverState{}, err
+	}
+	failed, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return NameserverState{}, err
+	}
+	return NameserverState{
+		IPAddress:              addr,
+		Port:                   port,
+		QueriesSent:            sent,
+		QueriesRetriedOrFailed: failed,
+		Provenance:             "system",
+		InUse:                  true,
+	}, nil
+}
+
+func queryChaosTXT(client *dnsclient.Client, server, name string) ([]string, error) {
+	resp, _, err := client.Exchange(
+		dnsclient.NewQuery(name, dnsclient.TypeTXT, dnsclient.ClassCHAOS),
+		server)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dnsclient.RcodeSuccess {
+		return nil, errors.New(name + ": " +
+			dnsclient.RcodeString(resp.Rcode))
+	}
+	var out []string
+	for _, rr := range resp.Answer {
+		if rr.Type != dnsclient.TypeTXT {
+			continue
+		}
+		out = append(out, rr.Strings...)
+	}
+	return out, nil
+}
+
 func readCacheStats(state *StateData, r io.Reader) error {
 	return byline.NewReader(r).
 		GrepByRegexp(regexp.MustCompile("cache size")).
@@ -383,7 +713,8 @@ func readNameserverStats(state *StateData, r io.Reader) error {
 	var nameservers []NameserverState
 
 	err := byline.NewReader(r).
-		GrepByRegexp(regexp.MustCompile("server")).
+		// Query log lines may mention names containing "server".
+		GrepByRegexp(regexp.MustCompile(`: server \S+: queries sent `)).
 		AWKMode(func(line string, fields []string, vars byline.AWKVars) (string, error) {
 			if len(fields) < 13 {
 				log.Dlog.Println("read-nameserver-stats:",
@@ -399,16 +730,14 @@ func readNameserverStats(state *StateData, r io.Reader) error {
 			if err != nil {
 				log.Dlog.Println("read-nameserver-stats:", "retried:", err)
 			}
-			serverPort := strings.Split(strings.Trim(fields[5], ":"), "#")
-			var server string
-			var port uint64
-			if len(serverPort) != 2 {
+			server, portStr, err := splitServerAddress(
+				strings.TrimSuffix(fields[5], ":"))
+			if err != nil || portStr == "" {
 				log.Dlog.Println("read-nameserver-stats:",
 					errors.New("invalid server line in log file: "+line))
 				return "", nil
 			}
-			server = serverPort[0]
-			port, err = strconv.ParseUint(serverPort[1], 10, 16)
+			port, err := strconv.ParseUint(portStr, 10, 16)
 			if err != nil {
 				log.Dlog.Println("read-nameserver-stats:", "port:", err)
 			}
@@ -477,8 +806,12 @@ func readPPPNs() []string {
 }
 
 type dnsMasqNs struct {
-	Server string
-	Domain string
+	Server          string
+	Port            uint16
+	Domain          string
+	Transport       string
+	Provenance      string
+	RoutingInstance string
 }
 
 func readDnsmasqNs(r io.Reader) []dnsMasqNs {
@@ -486,17 +819,76 @@ func readDnsmasqNs(r io.Reader) []dnsMasqNs {
 
 	serverExp := regexp.MustCompile("server=")
 	confDirExp := regexp.MustCompile("conf-dir=")
+	serversFileExp := regexp.MustCompile("^servers-file=")
 	err := byline.NewReader(r).
 		SetFS(regexp.MustCompile("[=\\s]+")).
 		AWKMode(func(line string, fields []string, vars byline.AWKVars) (string, error) {
 			switch {
+			case serversFileExp.MatchString(line):
+				f, err := os.Open(fields[1])
+				if err != nil {
+					log.Dlog.Println("read-dnsmasq-servers-file:", err)
+					return "", nil
+				}
+				ns = append(ns, readDnsmasqNs(f)...)
+				f.Close()
+				return "", nil
 			case serverExp.MatchString(line):
-				if fields[3] == "domain-override" {
+				if fields[3] == "tls-proxy" {
+					// The proxy itself is not a name server, the
+					// servers behind it follow the comment.
+					for _, server := range fields[4:] {
+						ns = append(ns, dnsMasqNs{
+							Server:     server,
+							Port:       tlsPort,
+							Transport:  "tls",
+							Provenance: "configuration",
+						})
+					}
+					return "", nil
+				}
+				if fields[3] == "relay" && len(fields) > 5 {
+					// The relay forwards to a name server in
+					// another routing instance.
+					ns = append(ns, dnsMasqNs{
+						Server:          fields[5],
+						Port:            defaultPort,
+						Provenance:      "configuration",
+						RoutingInstance: fields[4],
+					})
+					return "", nil
+				}
+				var domain string
+				server := fields[1]
+				if strings.HasPrefix(server, "/") {
 					domIp := strings.Split(fields[1], "/")
-					ns = append(ns, dnsMasqNs{Server: domIp[2], Domain: domIp[1]})
-				} else {
-					ns = append(ns, dnsMasqNs{Server: fields[1]})
+					domain, server = domIp[1], domIp[2]
+				}
+				if server == "" {
+					// Answered locally, never forwarded.
+					return "", nil
+				}
+				provenance := "configuration"
+				switch fields[3] {
+				case "dhcpv6", "slaac":
+					provenance = fields[3]
+				}
+				addr, port, err := parseServerAddress(server)
+				if err != nil {
+					log.Dlog.Println("read-dnsmasq-nameservers:", err)
+					return "", nil
+				}
+				// dnsmasq reports link-local servers without their
+				// scope in its statistics.
+				if i := strings.IndexByte(addr, '%'); i >= 0 {
+					addr = addr[:i]
 				}
+				ns = append(ns, dnsMasqNs{
+					Server:     addr,
+					Port:       port,
+					Domain:     domain,
+					Provenance: provenance,
+				})
 				return "", nil
 			case confDirExp.MatchString(line):
 				dirGlob := strings.Split(fields[1], ",")
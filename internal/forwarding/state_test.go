@@ -3,9 +3,11 @@
 package forwarding
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestReadStateData(t *testing.T) {
@@ -226,3 +228,206 @@ nameserver	208.201.224.33
 		t.Fatal("didn't get expected value")
 	}
 }
+
+func TestReadStateDataWithProvenanceIPv6(t *testing.T) {
+	const sample = `
+Jul 23 11:57:35 dnsmasq[28935]: time 1532372255
+Jul 23 11:57:35 dnsmasq[28935]: cache size 150, 0/10 cache insertions re-used unexpired cache entries.
+Jul 23 11:57:35 dnsmasq[28935]: queries forwarded 30, queries answered locally 10
+Jul 23 11:57:35 dnsmasq[28935]: queries for authoritative zones 0
+Jul 23 11:57:35 dnsmasq[28935]: server 2001:db8::1#53: queries sent 5, retried or failed 1
+Jul 23 11:57:35 dnsmasq[28935]: server 2001:db8::53#5353: queries sent 7, retried or failed 0
+Jul 23 11:57:35 dnsmasq[28935]: server 2001:db8::53#53: queries sent 3, retried or failed 2
+`
+	const dnsmasqConf = `
+no-poll
+interface=eth0
+cache-size=150
+server=2001:db8::1	# statically configured
+server=/att.com/2001:db8::53#5353	# domain-override
+server=/eng.att.com/2001:db8::53	# domain-override
+server=/bad.att.com/2001:db8::zz	# domain-override
+no-hosts
+`
+	expected := &StateData{}
+	expected.State.QueriesForwarded = 30
+	expected.State.QueriesAnswered = 10
+	expected.State.Cache.Size = 150
+	expected.State.Cache.Entries = 10
+	expected.State.Nameservers = []NameserverState{
+		{
+			IPAddress:              "2001:db8::1",
+			Port:                   53,
+			QueriesSent:            5,
+			QueriesRetriedOrFailed: 1,
+			Provenance:             "configuration",
+			InUse:                  true,
+		},
+		{
+			IPAddress:              "2001:db8::53",
+			Port:                   5353,
+			QueriesSent:            7,
+			QueriesRetriedOrFailed: 0,
+			Provenance:             "configuration",
+			InUse:                  true,
+			DomainOverrideOnly:     true,
+			Domains:                []string{"att.com"},
+		},
+		{
+			IPAddress:              "2001:db8::53",
+			Port:                   53,
+			QueriesSent:            3,
+			QueriesRetriedOrFailed: 2,
+			Provenance:             "configuration",
+			InUse:                  true,
+			DomainOverrideOnly:     true,
+			Domains:                []string{"eng.att.com"},
+		},
+	}
+	sr := &stateReader{
+		dnsmasqStateReader: strings.NewReader(sample),
+		dnsmasqConfReader:  strings.NewReader(dnsmasqConf),
+		resolvConfReader:   strings.NewReader(""),
+	}
+	data := sr.Read()
+	if !reflect.DeepEqual(data, expected) {
+		t.Log("got", data)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected value")
+	}
+}
+
+func TestQueryStateData(t *testing.T) {
+	answers := map[string][]string{
+		"cachesize.bind":  {"150"},
+		"insertions.bind": {"1213146"},
+		"evictions.bind":  {"83961"},
+		"hits.bind":       {"229001"},
+		"misses.bind":     {"363690"},
+		"servers.bind": {
+			"172.22.102.1#53 0 0",
+			"2001:db8::1#5353 15524 412",
+			"bogus",
+		},
+	}
+	expected := &StateData{}
+	expected.State.QueriesForwarded = 363690
+	expected.State.QueriesAnswered = 229001
+	expected.State.Cache.Size = 150
+	expected.State.Cache.Entries = 1213146
+	expected.State.Cache.ReusedEntries = 83961
+	expected.State.Nameservers = []NameserverState{
+		{
+			IPAddress:              "172.22.102.1",
+			Port:                   53,
+			QueriesSent:            0,
+			QueriesRetriedOrFailed: 0,
+			Provenance:             "system",
+			InUse:                  true,
+		},
+		{
+			IPAddress:              "2001:db8::1",
+			Port:                   5353,
+			QueriesSent:            15524,
+			QueriesRetriedOrFailed: 412,
+			Provenance:             "system",
+			InUse:                  true,
+		},
+	}
+	data, err := queryStateData(func(name string) ([]string, error) {
+		return answers[name], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Log("got", data)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected value")
+	}
+}
+
+func TestQueryStateDataMissingCounter(t *testing.T) {
+	_, err := queryStateData(func(name string) ([]string, error) {
+		return nil, nil
+	})
+	if err == nil {
+		t.Fatal("expected an error for an empty answer")
+	}
+}
+
+func TestStateDump(t *testing.T) {
+	const sample = `Jul 23 11:57:34 dnsmasq[28935]: query[A] example.com from 192.0.2.10
+Jul 23 11:57:35 dnsmasq[28935]: time 1532372255
+Jul 23 11:57:35 dnsmasq[28935]: cache size 150, 83961/1213146 cache insertions re-used unexpired cache entries.
+Jul 23 11:57:35 dnsmasq[28935]: queries forwarded 363690, queries answered locally 229001
+Jul 23 11:57:35 dnsmasq[28935]: queries for authoritative zones 0
+Jul 23 11:57:35 dnsmasq[28935]: server 8.8.8.8#53: queries sent 293857, retried or failed 606
+Jul 23 11:57:35 dnsmasq[28935]: Host                                     Address                                  Flags      Expires
+Jul 23 11:57:35 dnsmasq[28935]: example.com                              192.0.2.1                                4F         Thu Jul 23 12:57:35 2018`
+	d := newStateDump()
+	d.idle = time.Millisecond
+	for _, line := range strings.Split(sample, "\n") {
+		d.readLine(line)
+	}
+	data, err := d.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(sample, "\n")
+	expected := strings.Join(lines[1:6], "\n") + "\n"
+	if string(data) != expected {
+		t.Log("got", string(data))
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected statistics")
+	}
+}
+
+func TestStateDumpTimeout(t *testing.T) {
+	d := newStateDump()
+	d.timeout = time.Millisecond
+	d.readLine("Jul 23 11:57:34 dnsmasq[28935]: query[A] example.com from 192.0.2.10")
+	_, err := d.wait()
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+}
+
+func TestStateGetKeepsCollectedState(t *testing.T) {
+	collected := &StateData{}
+	collected.State.Nameservers = []NameserverState{
+		{IPAddress: "8.8.8.8", Port: 53, QueriesSent: 10},
+	}
+	health := newHealthChecker(nil)
+	health.servers["8.8.8.8"] = &serverHealth{
+		target: healthTarget{Address: "8.8.8.8", Port: 53},
+		probed: true,
+		up:     true,
+	}
+	s := &State{
+		policy: "strict-order",
+		health: health,
+		followedLog: func() ([]byte, bool, error) {
+			return nil, true, errors.New("timed out")
+		},
+	}
+	s.state.Store(collected)
+
+	state := s.Get()
+	if state == collected {
+		t.Fatal("collected state returned")
+	}
+	if state.State.ForwardingPolicy != "strict-order" ||
+		state.State.Nameservers[0].Status != "up" {
+		t.Fatal("state not merged", state)
+	}
+	expected := &StateData{}
+	expected.State.Nameservers = []NameserverState{
+		{IPAddress: "8.8.8.8", Port: 53, QueriesSent: 10},
+	}
+	if !reflect.DeepEqual(collected, expected) {
+		t.Log("got", collected)
+		t.Log("expected", expected)
+		t.Fatal("collected state changed")
+	}
+}
@@ -3,6 +3,7 @@
 package forwarding
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"regexp"
@@ -35,6 +36,7 @@ type systemConfig struct {
 	watcher   *systemWatcher
 	watchFile string
 	confFile  string
+	notify    func()
 }
 
 func (c *systemConfig) removeConfFile() {
@@ -52,7 +54,8 @@ func (c *systemConfig) Set(system bool) error {
 	} else {
 		c.watcher.stop()
 		c.removeConfFile()
-		c.watcher = startSystemWatcher(c.proc, c.confFile, c.watchFile)
+		c.watcher = startSystemWatcher(c.proc, c.confFile, c.watchFile,
+			c.notify)
 	}
 	return nil
 }
@@ -65,16 +68,22 @@ type systemWatcher struct {
 	watcher   *fswatcher.Watcher
 	confFile  string
 	watchFile string
+	notify    func()
 }
 
-func startSystemWatcher(proc process.Process, confFile, watchFile string) *systemWatcher {
+func startSystemWatcher(
+	proc process.Process,
+	confFile, watchFile string,
+	notify func(),
+) *systemWatcher {
 	out := &systemWatcher{
 		proc:      proc,
 		confFile:  confFile,
 		watchFile: watchFile,
+		notify:    notify,
 	}
 	if _, err := os.Stat(watchFile); err == nil {
-		err := out.writeConffileFromResolv(watchFile)
+		_, err := out.writeConffileFromResolv(watchFile)
 		if err != nil {
 			log.Dlog.Println("system nameserver watcher:", err)
 		}
@@ -87,32 +96,36 @@ func startSystemWatcher(proc process.Process, confFile, watchFile string) *syste
 	return out
 }
 
-func (w *systemWatcher) writeConffileFromResolv(resolv string) error {
+func (w *systemWatcher) writeConffileFromResolv(resolv string) (bool, error) {
 	f, err := os.Open(resolv)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer f.Close()
 
-	out, err := os.OpenFile(w.confFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	err = writeDnsmasqSystemConfig(out, readSystemNameservers(f))
+	var buf bytes.Buffer
+	err = writeDnsmasqSystemConfig(&buf, readSystemNameservers(f))
 	if err != nil {
-		return err
+		return false, err
 	}
-	return nil
+	return writeFileIfChanged(w.confFile, buf.Bytes())
 }
 
 func (w *systemWatcher) createOrWrite(name string) error {
-	err := w.writeConffileFromResolv(name)
+	changed, err := w.writeConffileFromResolv(name)
+	if err != nil || !changed {
+		// resolv.conf is rewritten for changes that don't concern
+		// the name servers, e.g. the search domains.
+		return err
+	}
+	err = w.proc.Restart()
 	if err != nil {
 		return err
 	}
-	return w.proc.Restart()
+	if w.notify != nil {
+		w.notify()
+	}
+	return nil
 }
 
 func (w *systemWatcher) CloseWrite(name string) error {
@@ -0,0 +1,235 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+	"github.com/danos/vyatta-service-dns/internal/log"
+	"github.com/danos/vyatta-service-dns/internal/process"
+)
+
+// The TLS proxy listens on the loopback address of the instance,
+// dnsmasq forwards everything destined for a TLS name server to it.
+const (
+	tlsProxyAddress = "127.0.0.1"
+	tlsProxyPort    = 8853
+	tlsPort         = 853
+)
+
+const stubbyFile = `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+resolution_type: GETDNS_RESOLUTION_STUB
+dns_transport_list:
+  - GETDNS_TRANSPORT_TLS
+tls_authentication: GETDNS_AUTHENTICATION_REQUIRED
+tls_query_padding_blocksize: 128
+idle_timeout: 10000
+round_robin_upstreams: 0
+listen_addresses:
+  - {{.Listen}}
+upstream_recursive_servers:
+{{- range .Servers}}
+  - address_data: {{.Address}}
+    tls_port: {{$.TLSPort}}
+{{- with .TLS}}
+{{- with .AuthName}}
+    tls_auth_name: "{{.}}"
+{{- end}}
+{{- with .SPKIPins}}
+    tls_pubkey_pinset:
+{{- range .}}
+      - digest: "sha256"
+        value: {{.}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}
+`
+
+var stubbyFileTemplate *template.Template
+
+func init() {
+	t := template.New("StubbyConf")
+	t.Funcs(template.FuncMap{})
+	stubbyFileTemplate = template.Must(t.Parse(stubbyFile))
+}
+
+type NameserverParameters struct {
+	Address         string         `rfc7951:"address"`
+	Transport       string         `rfc7951:"transport,omitempty"`
+	TLS             *TLSParameters `rfc7951:"tls,omitempty"`
+	RoutingInstance string         `rfc7951:"routing-instance,omitempty"`
+	Priority        uint32         `rfc7951:"priority,omitempty"`
+}
+
+type TLSParameters struct {
+	AuthName string   `rfc7951:"auth-name,omitempty"`
+	SPKIPins []string `rfc7951:"spki-pin,omitempty"`
+}
+
+func (c *ConfigData) nameserverParameters(addr string) *NameserverParameters {
+	for i := range c.NameserverParameters {
+		if c.NameserverParameters[i].Address == addr {
+			return &c.NameserverParameters[i]
+		}
+	}
+	return nil
+}
+
+func (c *ConfigData) useTLS(addr string) bool {
+	params := c.nameserverParameters(addr)
+	return params != nil && params.Transport == "tls"
+}
+
+// plainNameservers returns the statically configured name servers that
+// dnsmasq queries directly, by priority.
+func (c *ConfigData) plainNameservers(instance string) []string {
+	var out []string
+	for _, ns := range c.orderedNameservers() {
+		if c.useTLS(ns) || c.useRelay(ns, instance) {
+			continue
+		}
+		out = append(out, ns)
+	}
+	return out
+}
+
+// tlsNameservers returns the statically configured name servers that
+// are reached through the TLS proxy, by priority.
+func (c *ConfigData) tlsNameservers() []NameserverParameters {
+	var out []NameserverParameters
+	for _, ns := range c.orderedNameservers() {
+		if !c.useTLS(ns) {
+			continue
+		}
+		out = append(out, *c.nameserverParameters(ns))
+	}
+	return out
+}
+
+func writeStubbyConfig(w io.Writer, servers []NameserverParameters) error {
+	tmplInput := struct {
+		Listen  string
+		TLSPort int
+		Servers []NameserverParameters
+	}{
+		Listen:  tlsProxyAddress + "@" + strconv.Itoa(tlsProxyPort),
+		TLSPort: tlsPort,
+		Servers: servers,
+	}
+	return stubbyFileTemplate.Execute(w, &tmplInput)
+}
+
+// tlsProxyConfig supervises the TLS stub proxy of an instance. The
+// process only exists while TLS name servers are configured.
+type tlsProxyConfig struct {
+	newProc  func() process.Process
+	proc     process.Process
+	confFile string
+	current  []byte
+}
+
+func (c *tlsProxyConfig) Set(servers []NameserverParameters) error {
+	if len(servers) == 0 {
+		return c.stop()
+	}
+
+	var buf bytes.Buffer
+	err := writeStubbyConfig(&buf, servers)
+	if err != nil {
+		return err
+	}
+	if c.proc != nil && bytes.Equal(buf.Bytes(), c.current) {
+		return nil
+	}
+	err = ioutil.WriteFile(c.confFile, buf.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	if c.proc == nil {
+		c.proc = c.newProc()
+	}
+	// Forget the old configuration until the restart succeeds so
+	// that setting it again retries.
+	c.current = nil
+	err = c.proc.Restart()
+	if err != nil {
+		return err
+	}
+	c.current = buf.Bytes()
+	return nil
+}
+
+func (c *tlsProxyConfig) stop() error {
+	if c.proc == nil {
+		return nil
+	}
+	err := c.proc.Stop()
+	c.proc = nil
+	c.current = nil
+	if rerr := os.Remove(c.confFile); rerr != nil {
+		log.Dlog.Println("tls-proxy-config:", rerr)
+	}
+	return err
+}
+
+// probeTLSProxy reports whether the proxy is able to get answers from
+// its upstreams.
+func probeTLSProxy(device string) bool {
+	client := &dnsclient.Client{
+		Timeout: time.Second,
+		Device:  device,
+	}
+	resp, _, err := client.Exchange(
+		dnsclient.NewQuery(".", dnsclient.TypeNS, dnsclient.ClassINET),
+		net.JoinHostPort(tlsProxyAddress, strconv.Itoa(tlsProxyPort)))
+	if err != nil {
+		log.Dlog.Println("tls-proxy-probe:", err)
+		return false
+	}
+	return resp.Rcode == dnsclient.RcodeSuccess ||
+		resp.Rcode == dnsclient.RcodeNameError
+}
+
+// mergeTLSProxyState replaces the statistics dnsmasq keeps for the
+// proxy with the TLS name servers behind it. The counters are shared
+// by all of those name servers.
+func mergeTLSProxyState(state *StateData, up bool) {
+	var proxy *NameserverState
+	var nameservers []NameserverState
+	for i, ns := range state.State.Nameservers {
+		if ns.IPAddress == tlsProxyAddress && ns.Port == tlsProxyPort {
+			proxy = &state.State.Nameservers[i]
+			continue
+		}
+		nameservers = append(nameservers, ns)
+	}
+
+	status := "down"
+	if up {
+		status = "up"
+	}
+	for i := range nameservers {
+		ns := &nameservers[i]
+		if ns.Transport != "tls" {
+			continue
+		}
+		ns.TLSProxyStatus = status
+		if proxy != nil {
+			ns.QueriesSent = proxy.QueriesSent
+			ns.QueriesRetriedOrFailed = proxy.QueriesRetriedOrFailed
+		}
+	}
+	state.State.Nameservers = nameservers
+}
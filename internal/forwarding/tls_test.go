@@ -0,0 +1,166 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func tlsTestConfig() *ConfigData {
+	return &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		Nameservers:      []string{"1.1.1.1", "192.0.2.53", "9.9.9.9"},
+		NameserverParameters: []NameserverParameters{
+			{
+				Address:   "9.9.9.9",
+				Transport: "tls",
+				TLS: &TLSParameters{
+					AuthName: "dns.quad9.net",
+				},
+			},
+			{
+				Address:   "1.1.1.1",
+				Transport: "tls",
+				TLS: &TLSParameters{
+					AuthName: "cloudflare-dns.com",
+					SPKIPins: []string{
+						"GP8Knf7qBae+aIfythytMbYnL+yowaWVeD6MoLHkVRg=",
+					},
+				},
+			},
+			{
+				Address:   "192.0.2.53",
+				Transport: "udp",
+			},
+		},
+	}
+}
+
+func TestWriteForwardingConfigTLS(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewConfig().writeForwardingConfig(&buf, tlsTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+log-facility=/var/log/dnsmasq.log
+no-poll
+edns-packet-max=4096
+interface=eth0
+cache-size=150
+server=127.0.0.1#8853	# tls-proxy 1.1.1.1 9.9.9.9
+server=192.0.2.53	# statically configured
+resolv-file=/etc/dnsmasq.conf
+no-hosts
+addn-hosts=/etc/hosts
+conf-dir=/etc/dnsmasq.d,*.conf
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestWriteStubbyConfig(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeStubbyConfig(&buf, tlsTestConfig().tlsNameservers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `### Autogenerated by vci-service-dns
+### Note: Manual changes to this file will be lost during
+###       the next commit.
+resolution_type: GETDNS_RESOLUTION_STUB
+dns_transport_list:
+  - GETDNS_TRANSPORT_TLS
+tls_authentication: GETDNS_AUTHENTICATION_REQUIRED
+tls_query_padding_blocksize: 128
+idle_timeout: 10000
+round_robin_upstreams: 0
+listen_addresses:
+  - 127.0.0.1@8853
+upstream_recursive_servers:
+  - address_data: 1.1.1.1
+    tls_port: 853
+    tls_auth_name: "cloudflare-dns.com"
+    tls_pubkey_pinset:
+      - digest: "sha256"
+        value: GP8Knf7qBae+aIfythytMbYnL+yowaWVeD6MoLHkVRg=
+  - address_data: 9.9.9.9
+    tls_port: 853
+    tls_auth_name: "dns.quad9.net"
+`
+	if buf.String() != expected {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestReadStateDataWithTLSProxy(t *testing.T) {
+	const sample = `
+Jul 23 11:57:35 dnsmasq[28935]: cache size 150, 0/10 cache insertions re-used unexpired cache entries.
+Jul 23 11:57:35 dnsmasq[28935]: queries forwarded 20, queries answered locally 5
+Jul 23 11:57:35 dnsmasq[28935]: server 192.0.2.53#53: queries sent 4, retried or failed 1
+Jul 23 11:57:35 dnsmasq[28935]: server 127.0.0.1#8853: queries sent 16, retried or failed 2
+`
+	var conf bytes.Buffer
+	err := NewConfig().writeForwardingConfig(&conf, tlsTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &stateReader{
+		dnsmasqStateReader: strings.NewReader(sample),
+		resolvConfReader:   strings.NewReader(""),
+		dnsmasqConfReader:  &conf,
+	}
+	state := reader.Read()
+	mergeTLSProxyState(state, true)
+
+	expected := map[string]NameserverState{
+		"192.0.2.53": {
+			IPAddress:              "192.0.2.53",
+			Port:                   53,
+			QueriesSent:            4,
+			QueriesRetriedOrFailed: 1,
+			Provenance:             "configuration",
+			InUse:                  true,
+		},
+		"1.1.1.1": {
+			IPAddress:              "1.1.1.1",
+			Port:                   853,
+			QueriesSent:            16,
+			QueriesRetriedOrFailed: 2,
+			Provenance:             "configuration",
+			InUse:                  true,
+			Transport:              "tls",
+			TLSProxyStatus:         "up",
+		},
+		"9.9.9.9": {
+			IPAddress:              "9.9.9.9",
+			Port:                   853,
+			QueriesSent:            16,
+			QueriesRetriedOrFailed: 2,
+			Provenance:             "configuration",
+			InUse:                  true,
+			Transport:              "tls",
+			TLSProxyStatus:         "up",
+		},
+	}
+	got := make(map[string]NameserverState)
+	for _, ns := range state.State.Nameservers {
+		got[ns.IPAddress] = ns
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Log("got", got)
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected name servers")
+	}
+}
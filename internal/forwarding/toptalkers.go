@@ -0,0 +1,208 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTopTalkersWindow     = 300
+	defaultTopTalkersEntries    = 10
+	defaultTopTalkersMaxTracked = 10000
+	// The window rolls over in this many steps.
+	topTalkersBuckets = 10
+)
+
+type TopTalkers struct {
+	// Window is the time in seconds queries are counted for.
+	Window  uint32 `rfc7951:"window,omitempty"`
+	Entries uint32 `rfc7951:"entries,omitempty"`
+	// MaxTracked bounds the number of clients and names counted for
+	// the window.
+	MaxTracked uint32 `rfc7951:"max-tracked,omitempty"`
+}
+
+func (t *TopTalkers) window() time.Duration {
+	if t.Window == 0 {
+		return defaultTopTalkersWindow * time.Second
+	}
+	return time.Duration(t.Window) * time.Second
+}
+
+func (t *TopTalkers) entries() int {
+	if t.Entries == 0 {
+		return defaultTopTalkersEntries
+	}
+	return int(t.Entries)
+}
+
+func (t *TopTalkers) maxTracked() int {
+	if t.MaxTracked == 0 {
+		return defaultTopTalkersMaxTracked
+	}
+	return int(t.MaxTracked)
+}
+
+type TopClientState struct {
+	Address string `rfc7951:"address"`
+	Queries uint64 `rfc7951:"queries"`
+}
+
+type TopNameState struct {
+	Name    string `rfc7951:"name"`
+	Queries uint64 `rfc7951:"queries"`
+}
+
+// talkerCounts counts the queries of a single step of the window.
+type talkerCounts struct {
+	start    time.Time
+	clients  map[string]uint64
+	names    map[string]uint64
+	nxdomain map[string]uint64
+}
+
+func (b *talkerCounts) reset(start time.Time) {
+	b.start = start
+	b.clients = make(map[string]uint64)
+	b.names = make(map[string]uint64)
+	b.nxdomain = make(map[string]uint64)
+}
+
+// topTalkers counts queries by client and by name over a rolling
+// window. Once a step of the window tracks its share of max-tracked
+// clients or names, new ones are not counted until the next step.
+type topTalkers struct {
+	mu      sync.Mutex
+	params  TopTalkers
+	now     func() time.Time
+	buckets [topTalkersBuckets]talkerCounts
+}
+
+func newTopTalkers(params TopTalkers) *topTalkers {
+	return &topTalkers{
+		params: params,
+		now:    time.Now,
+	}
+}
+
+func (t *topTalkers) step() time.Duration {
+	return t.params.window() / topTalkersBuckets
+}
+
+func (t *topTalkers) bucketLimit() int {
+	limit := t.params.maxTracked() / topTalkersBuckets
+	if limit == 0 {
+		return 1
+	}
+	return limit
+}
+
+func countBounded(counts map[string]uint64, key string, limit int) {
+	if _, ok := counts[key]; !ok && len(counts) >= limit {
+		return
+	}
+	counts[key]++
+}
+
+func (t *topTalkers) add(rec *QueryRecord) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	step := t.step()
+	start := t.now().Truncate(step)
+	b := &t.buckets[(start.UnixNano()/int64(step))%topTalkersBuckets]
+	if !b.start.Equal(start) {
+		b.reset(start)
+	}
+	limit := t.bucketLimit()
+	countBounded(b.clients, rec.Client, limit)
+	countBounded(b.names, rec.Name, limit)
+	if rec.Rcode == "NXDOMAIN" {
+		countBounded(b.nxdomain, rec.Name, limit)
+	}
+}
+
+type talkerCount struct {
+	key   string
+	count uint64
+}
+
+// top returns the entries most queried, most queried first.
+func top(total map[string]uint64, n int) []talkerCount {
+	out := make([]talkerCount, 0, len(total))
+	for key, count := range total {
+		out = append(out, talkerCount{key, count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].count != out[j].count {
+			return out[i].count > out[j].count
+		}
+		return out[i].key < out[j].key
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func (t *topTalkers) get() ([]TopClientState, []TopNameState, []TopNameState) {
+	if t == nil {
+		return nil, nil, nil
+	}
+	t.mu.Lock()
+	clients := make(map[string]uint64)
+	names := make(map[string]uint64)
+	nxdomain := make(map[string]uint64)
+	oldest := t.now().Add(-t.params.window())
+	for i := range t.buckets {
+		b := &t.buckets[i]
+		if b.start.IsZero() || !b.start.After(oldest) {
+			continue
+		}
+		for _, sum := range []struct{ to, from map[string]uint64 }{
+			{clients, b.clients},
+			{names, b.names},
+			{nxdomain, b.nxdomain},
+		} {
+			for key, count := range sum.from {
+				sum.to[key] += count
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	n := t.params.entries()
+	var topClients []TopClientState
+	for _, c := range top(clients, n) {
+		topClients = append(topClients,
+			TopClientState{Address: c.key, Queries: c.count})
+	}
+	nameStates := func(counts map[string]uint64) []TopNameState {
+		var out []TopNameState
+		for _, c := range top(counts, n) {
+			out = append(out, TopNameState{Name: c.key, Queries: c.count})
+		}
+		return out
+	}
+	return topClients, nameStates(names), nameStates(nxdomain)
+}
+
+func (c *Config) getTopTalkers() *topTalkers {
+	return c.topTalkers.Load().(*topTalkers)
+}
+
+func (c *Config) updateTopTalkers(conf *ConfigData) {
+	if conf == nil || conf.TopTalkers == nil {
+		c.topTalkers.Store((*topTalkers)(nil))
+		return
+	}
+	if cur := c.getTopTalkers(); cur != nil && cur.params == *conf.TopTalkers {
+		return
+	}
+	c.topTalkers.Store(newTopTalkers(*conf.TopTalkers))
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTopTalkers(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	talkers := newTopTalkers(TopTalkers{Window: 60, Entries: 2})
+	talkers.now = func() time.Time { return now }
+	for _, rec := range []QueryRecord{
+		{Client: "192.0.2.10", Name: "example.com", Rcode: "NOERROR"},
+		{Client: "192.0.2.10", Name: "example.com", Rcode: "NOERROR"},
+		{Client: "192.0.2.11", Name: "missing.example", Rcode: "NXDOMAIN"},
+		{Client: "192.0.2.12", Name: "example.org", Rcode: "NOERROR"},
+		{Client: "192.0.2.11", Name: "missing.example", Rcode: "NXDOMAIN"},
+		{Client: "192.0.2.10", Name: "gone.example", Rcode: "NXDOMAIN"},
+	} {
+		rec := rec
+		talkers.add(&rec)
+	}
+
+	clients, names, nxdomain := talkers.get()
+	if !reflect.DeepEqual(clients, []TopClientState{
+		{Address: "192.0.2.10", Queries: 3},
+		{Address: "192.0.2.11", Queries: 2},
+	}) {
+		t.Fatal("unexpected top clients", clients)
+	}
+	if !reflect.DeepEqual(names, []TopNameState{
+		{Name: "example.com", Queries: 2},
+		{Name: "missing.example", Queries: 2},
+	}) {
+		t.Fatal("unexpected top names", names)
+	}
+	if !reflect.DeepEqual(nxdomain, []TopNameState{
+		{Name: "missing.example", Queries: 2},
+		{Name: "gone.example", Queries: 1},
+	}) {
+		t.Fatal("unexpected top NXDOMAIN names", nxdomain)
+	}
+
+	// Queries older than the window are no longer counted.
+	now = now.Add(30 * time.Second)
+	talkers.add(&QueryRecord{Client: "192.0.2.12", Name: "example.org"})
+	now = now.Add(40 * time.Second)
+	clients, names, nxdomain = talkers.get()
+	if !reflect.DeepEqual(clients, []TopClientState{
+		{Address: "192.0.2.12", Queries: 1},
+	}) {
+		t.Fatal("unexpected top clients", clients)
+	}
+	if !reflect.DeepEqual(names, []TopNameState{
+		{Name: "example.org", Queries: 1},
+	}) {
+		t.Fatal("unexpected top names", names)
+	}
+	if nxdomain != nil {
+		t.Fatal("unexpected top NXDOMAIN names", nxdomain)
+	}
+}
+
+func TestTopTalkersMaxTracked(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	talkers := newTopTalkers(TopTalkers{MaxTracked: 20})
+	talkers.now = func() time.Time { return now }
+	for _, client := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3",
+		"192.0.2.1"} {
+		talkers.add(&QueryRecord{Client: client, Name: "example.com"})
+	}
+	clients, _, _ := talkers.get()
+	if !reflect.DeepEqual(clients, []TopClientState{
+		{Address: "192.0.2.1", Queries: 2},
+		{Address: "192.0.2.2", Queries: 1},
+	}) {
+		t.Fatal("unexpected top clients", clients)
+	}
+}
+
+func TestUpdateTopTalkers(t *testing.T) {
+	conf := NewConfig()
+	conf.updateTopTalkers(&ConfigData{TopTalkers: &TopTalkers{}})
+	talkers := conf.getTopTalkers()
+	if talkers == nil {
+		t.Fatal("top talkers not enabled")
+	}
+	conf.updateTopTalkers(&ConfigData{TopTalkers: &TopTalkers{}})
+	if conf.getTopTalkers() != talkers {
+		t.Fatal("counts lost on unchanged configuration")
+	}
+	conf.updateTopTalkers(&ConfigData{})
+	if conf.getTopTalkers() != nil {
+		t.Fatal("top talkers not disabled")
+	}
+}
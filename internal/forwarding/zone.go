@@ -0,0 +1,189 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"strconv"
+	"strings"
+)
+
+type LocalZone struct {
+	Name   string             `rfc7951:"name"`
+	Hosts  []LocalHostRecord  `rfc7951:"host,omitempty"`
+	CNAMEs []LocalCNAMERecord `rfc7951:"cname,omitempty"`
+	MXs    []LocalMXRecord    `rfc7951:"mx,omitempty"`
+	SRVs   []LocalSRVRecord   `rfc7951:"srv,omitempty"`
+	TXTs   []LocalTXTRecord   `rfc7951:"txt,omitempty"`
+	PTRs   []LocalPTRRecord   `rfc7951:"ptr,omitempty"`
+}
+
+// Record names are relative to the zone, "@" is the zone itself.
+
+type LocalHostRecord struct {
+	Name      string   `rfc7951:"name"`
+	Addresses []string `rfc7951:"address,omitempty"`
+}
+
+type LocalCNAMERecord struct {
+	Name   string `rfc7951:"name"`
+	Target string `rfc7951:"target"`
+}
+
+type LocalMXRecord struct {
+	Name       string `rfc7951:"name"`
+	Exchange   string `rfc7951:"exchange"`
+	Preference uint16 `rfc7951:"preference"`
+}
+
+type LocalSRVRecord struct {
+	Service  string `rfc7951:"service"`
+	Protocol string `rfc7951:"protocol"`
+	Target   string `rfc7951:"target"`
+	Port     uint16 `rfc7951:"port"`
+	Priority uint16 `rfc7951:"priority"`
+	Weight   uint16 `rfc7951:"weight"`
+}
+
+type LocalTXTRecord struct {
+	Name   string   `rfc7951:"name"`
+	Values []string `rfc7951:"value,omitempty"`
+}
+
+type LocalPTRRecord struct {
+	Name   string `rfc7951:"name"`
+	Target string `rfc7951:"target"`
+}
+
+// ConfigError is a problem with the configuration that was found
+// before it was handed to dnsmasq. Path is relative to the forwarding
+// container.
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+func zoneFQDN(name, zone string) string {
+	if name == "@" {
+		return zone
+	}
+	return name + "." + zone
+}
+
+// txtStrings renders the character strings of a TXT record as quoted
+// dnsmasq arguments.
+func txtStrings(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.Replace(v, `\`, `\\`, -1)
+		v = strings.Replace(v, `"`, `\"`, -1)
+		quoted = append(quoted, `"`+v+`"`)
+	}
+	return strings.Join(quoted, ",")
+}
+
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// inLocalZone returns the local zone that name belongs to, if any.
+func (c *ConfigData) inLocalZone(name string) (string, bool) {
+	name = canonicalName(name)
+	for _, zone := range c.LocalZones {
+		z := canonicalName(zone.Name)
+		if name == z || strings.HasSuffix(name, "."+z) {
+			return zone.Name, true
+		}
+	}
+	return "", false
+}
+
+// validateLocalZones checks what dnsmasq would silently accept, but
+// not answer as expected.
+func (c *ConfigData) validateLocalZones() error {
+	// Names that carry data other than a CNAME.
+	names := make(map[string]struct{})
+	for _, mapping := range c.StaticHostMappings {
+		names[canonicalName(mapping.HostName)] = struct{}{}
+		for _, alias := range mapping.Aliases {
+			names[canonicalName(alias)] = struct{}{}
+		}
+	}
+	for _, zone := range c.LocalZones {
+		for _, r := range zone.Hosts {
+			names[canonicalName(zoneFQDN(r.Name, zone.Name))] = struct{}{}
+		}
+		for _, r := range zone.MXs {
+			names[canonicalName(zoneFQDN(r.Name, zone.Name))] = struct{}{}
+		}
+		for _, r := range zone.TXTs {
+			names[canonicalName(zoneFQDN(r.Name, zone.Name))] = struct{}{}
+		}
+		for _, r := range zone.PTRs {
+			names[canonicalName(zoneFQDN(r.Name, zone.Name))] = struct{}{}
+		}
+	}
+
+	cnames := make(map[string]string)
+	for _, zone := range c.LocalZones {
+		for _, r := range zone.CNAMEs {
+			path := "local-zone/" + zone.Name + "/cname/" + r.Name
+			name := canonicalName(zoneFQDN(r.Name, zone.Name))
+			if _, ok := names[name]; ok {
+				return &ConfigError{
+					Path:    path,
+					Message: "a CNAME cannot coexist with other records for " + name,
+				}
+			}
+			cnames[name] = canonicalName(r.Target)
+		}
+	}
+
+	for _, zone := range c.LocalZones {
+		for _, r := range zone.CNAMEs {
+			path := "local-zone/" + zone.Name + "/cname/" + r.Name
+			name := canonicalName(zoneFQDN(r.Name, zone.Name))
+			seen := map[string]struct{}{name: {}}
+			for target := cnames[name]; ; target = cnames[target] {
+				if _, ok := seen[target]; ok {
+					return &ConfigError{
+						Path:    path,
+						Message: "CNAME loop through " + target,
+					}
+				}
+				seen[target] = struct{}{}
+				if _, ok := cnames[target]; ok {
+					continue
+				}
+				_, known := names[target]
+				if z, local := c.inLocalZone(target); local && !known {
+					return &ConfigError{
+						Path: path,
+						Message: "target " + target +
+							" has no records in local zone " + z,
+					}
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// srvOwner returns the owner name of an SRV record in zone.
+func srvOwner(r LocalSRVRecord, zone string) string {
+	return "_" + r.Service + "._" + r.Protocol + "." + zone
+}
+
+func srvRecord(r LocalSRVRecord, zone string) string {
+	return strings.Join([]string{
+		srvOwner(r, zone),
+		r.Target,
+		strconv.Itoa(int(r.Port)),
+		strconv.Itoa(int(r.Priority)),
+		strconv.Itoa(int(r.Weight)),
+	}, ",")
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package forwarding
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testLocalZone() LocalZone {
+	return LocalZone{
+		Name: "corp.example",
+		Hosts: []LocalHostRecord{
+			{Name: "@", Addresses: []string{"192.0.2.1"}},
+			{Name: "web", Addresses: []string{"192.0.2.10", "2001:db8::10"}},
+		},
+		CNAMEs: []LocalCNAMERecord{
+			{Name: "www", Target: "web.corp.example"},
+		},
+		MXs: []LocalMXRecord{
+			{Name: "@", Exchange: "mail.example.net", Preference: 10},
+		},
+		SRVs: []LocalSRVRecord{
+			{Service: "ldap", Protocol: "tcp", Target: "web.corp.example",
+				Port: 389, Priority: 0, Weight: 5},
+		},
+		TXTs: []LocalTXTRecord{
+			{Name: "@", Values: []string{"v=spf1 -all", `say "hi"`}},
+		},
+		PTRs: []LocalPTRRecord{
+			{Name: "_http._tcp", Target: "web.corp.example"},
+		},
+	}
+}
+
+func TestWriteForwardingConfigLocalZone(t *testing.T) {
+	config := &ConfigData{
+		CacheSize:        150,
+		ListenInterfaces: []string{"eth0"},
+		LocalZones:       []LocalZone{testLocalZone()},
+	}
+	var buf bytes.Buffer
+	err := NewConfig().writeForwardingConfig(&buf, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `local=/corp.example/
+host-record=corp.example,192.0.2.1
+host-record=web.corp.example,192.0.2.10,2001:db8::10
+cname=www.corp.example,web.corp.example
+mx-host=corp.example,mail.example.net,10
+srv-host=_ldap._tcp.corp.example,web.corp.example,389,0,5
+txt-record=corp.example,"v=spf1 -all","say \"hi\""
+ptr-record=_http._tcp.corp.example,web.corp.example
+`
+	if !strings.Contains(buf.String(), expected) {
+		t.Log("got", buf.String())
+		t.Log("expected", expected)
+		t.Fatal("didn't get expected output")
+	}
+}
+
+func TestValidateLocalZones(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*LocalZone)
+		path   string
+	}{
+		{
+			name:   "valid",
+			modify: func(*LocalZone) {},
+		},
+		{
+			name: "cname-with-other-data",
+			modify: func(z *LocalZone) {
+				z.CNAMEs = append(z.CNAMEs,
+					LocalCNAMERecord{Name: "@", Target: "web.corp.example"})
+			},
+			path: "local-zone/corp.example/cname/@",
+		},
+		{
+			name: "cname-loop",
+			modify: func(z *LocalZone) {
+				z.CNAMEs = []LocalCNAMERecord{
+					{Name: "a", Target: "b.corp.example"},
+					{Name: "b", Target: "A.corp.example."},
+				}
+			},
+			path: "local-zone/corp.example/cname/a",
+		},
+		{
+			name: "unknown-local-target",
+			modify: func(z *LocalZone) {
+				z.CNAMEs[0].Target = "missing.corp.example"
+			},
+			path: "local-zone/corp.example/cname/www",
+		},
+		{
+			name: "external-target",
+			modify: func(z *LocalZone) {
+				z.CNAMEs[0].Target = "www.example.org"
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zone := testLocalZone()
+			test.modify(&zone)
+			conf := &ConfigData{LocalZones: []LocalZone{zone}}
+			err := conf.validateLocalZones()
+			if test.path == "" {
+				if err != nil {
+					t.Fatal("unexpected error", err)
+				}
+				return
+			}
+			cerr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatal("expected a ConfigError, got", err)
+			}
+			if cerr.Path != test.path {
+				t.Fatalf("got path %q, expected %q", cerr.Path, test.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package dns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dnsclient"
+	"github.com/danos/vyatta-service-dns/internal/dynamic"
+	"github.com/danos/vyatta-service-dns/internal/forwarding"
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+const (
+	defaultMetricsAddress = "127.0.0.1"
+	defaultMetricsPort    = 9153
+	// The metrics endpoint keeps trying to listen at this interval, the
+	// address or routing instance may not be available yet.
+	metricsRetryInterval = 10 * time.Second
+	metricsContentType   = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	// Scrapes within this time of each other are served the same
+	// metrics, collecting the state reads the logs of every instance.
+	metricsCacheTime         = 5 * time.Second
+	metricsReadHeaderTimeout = 5 * time.Second
+	metricsReadTimeout       = 10 * time.Second
+	metricsWriteTimeout      = 30 * time.Second
+)
+
+type MetricsConfigData struct {
+	Address         string `rfc7951:"listen-address,omitempty"`
+	Port            uint16 `rfc7951:"port,omitempty"`
+	RoutingInstance string `rfc7951:"vyatta-service-dns-routing-instance-v1:routing-instance,omitempty"`
+}
+
+func (m *MetricsConfigData) listenAddress() string {
+	addr := m.Address
+	if addr == "" {
+		addr = defaultMetricsAddress
+	}
+	port := int(m.Port)
+	if port == 0 {
+		port = defaultMetricsPort
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+func (m *MetricsConfigData) device() string {
+	if m.RoutingInstance == "" || m.RoutingInstance == "default" {
+		return ""
+	}
+	return "vrf" + m.RoutingInstance
+}
+
+type metricLabel struct {
+	name, value string
+}
+
+type metricSample struct {
+	labels []metricLabel
+	value  string
+}
+
+type metricFamily struct {
+	name, typ, help string
+	samples         []metricSample
+}
+
+// metricsWriter collects samples by family, OpenMetrics wants the
+// samples of a family to be written together.
+type metricsWriter struct {
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+func newMetricsWriter() *metricsWriter {
+	return &metricsWriter{byName: make(map[string]*metricFamily)}
+}
+
+func (m *metricsWriter) add(
+	name, typ, help, value string,
+	labels ...metricLabel,
+) {
+	f, ok := m.byName[name]
+	if !ok {
+		f = &metricFamily{name: name, typ: typ, help: help}
+		m.byName[name] = f
+		m.families = append(m.families, f)
+	}
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+func (m *metricsWriter) counter(name, help string, value uint64, labels ...metricLabel) {
+	m.add(name, "counter", help, strconv.FormatUint(value, 10), labels...)
+}
+
+func (m *metricsWriter) gauge(name, help string, value float64, labels ...metricLabel) {
+	m.add(name, "gauge", help, strconv.FormatFloat(value, 'g', -1, 64),
+		labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *metricsWriter) write(w io.Writer) error {
+	var b strings.Builder
+	for _, f := range m.families {
+		fmt.Fprintf(&b, "# TYPE %s %s\n# HELP %s %s\n",
+			f.name, f.typ, f.name, f.help)
+		name := f.name
+		if f.typ == "counter" {
+			name += "_total"
+		}
+		for _, s := range f.samples {
+			b.WriteString(name)
+			if len(s.labels) != 0 {
+				b.WriteString("{")
+				for i, l := range s.labels {
+					if i != 0 {
+						b.WriteString(",")
+					}
+					fmt.Fprintf(&b, `%s="%s"`, l.name,
+						labelEscaper.Replace(l.value))
+				}
+				b.WriteString("}")
+			}
+			fmt.Fprintf(&b, " %s\n", s.value)
+		}
+	}
+	b.WriteString("# EOF\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func collectForwardingMetrics(m *metricsWriter, instance string, data *forwarding.StateData) {
+	if data == nil {
+		return
+	}
+	state := &data.State
+	inst := metricLabel{"instance", instance}
+	m.counter("dns_forwarding_queries_forwarded",
+		"Queries forwarded to a name server.",
+		state.QueriesForwarded, inst)
+	m.counter("dns_forwarding_queries_answered",
+		"Queries answered from the cache.",
+		state.QueriesAnswered, inst)
+	m.gauge("dns_forwarding_cache_size",
+		"Size of the cache.",
+		float64(state.Cache.Size), inst)
+	m.counter("dns_forwarding_cache_insertions",
+		"Entries inserted into the cache.",
+		state.Cache.Entries, inst)
+	m.counter("dns_forwarding_cache_reused_entries",
+		"Unexpired cache entries reused for new ones.",
+		state.Cache.ReusedEntries, inst)
+	m.counter("dns_forwarding_cache_entries_restored",
+		"Entries put back into the cache after a restart.",
+		state.Cache.EntriesRestored, inst)
+	for _, ns := range state.Nameservers {
+		labels := []metricLabel{
+			inst,
+			{"address", ns.IPAddress},
+			{"port", strconv.Itoa(int(ns.Port))},
+		}
+		m.counter("dns_forwarding_nameserver_queries_sent",
+			"Queries sent to the name server.",
+			ns.QueriesSent, labels...)
+		m.counter("dns_forwarding_nameserver_queries_failed",
+			"Queries to the name server that were retried or failed.",
+			ns.QueriesRetriedOrFailed, labels...)
+		m.gauge("dns_forwarding_nameserver_in_use",
+			"Whether the name server is used.",
+			boolGauge(ns.InUse), labels...)
+		if ns.Status == "" {
+			continue
+		}
+		m.gauge("dns_forwarding_nameserver_up",
+			"Whether the name server answers health checks.",
+			boolGauge(ns.Status == "up"), labels...)
+		if ns.RoundTripTime != 0 {
+			m.gauge("dns_forwarding_nameserver_round_trip_time_seconds",
+				"Time the last successful health check took.",
+				float64(ns.RoundTripTime)/1000, labels...)
+		}
+	}
+	if state.DNSSEC != nil {
+		m.counter("dns_forwarding_dnssec_validated_answers",
+			"Answers validated as secure.",
+			state.DNSSEC.Validated, inst)
+		m.counter("dns_forwarding_dnssec_bogus_answers",
+			"Answers that failed validation.",
+			state.DNSSEC.Bogus, inst)
+	}
+	for _, bl := range state.Blocklists {
+		labels := []metricLabel{inst, {"blocklist", bl.Name}}
+		m.gauge("dns_forwarding_blocklist_entries",
+			"Domains blocked by the blocklist.",
+			float64(bl.Entries), labels...)
+		if bl.Hits != nil {
+			m.counter("dns_forwarding_blocklist_hits",
+				"Queries answered by the blocklist.",
+				*bl.Hits, labels...)
+		}
+	}
+}
+
+func collectDynamicMetrics(m *metricsWriter, instance string, data *dynamic.StateData) {
+	if data == nil {
+		return
+	}
+	for _, intf := range data.Status.Interfaces {
+		for _, host := range intf.Hosts {
+			labels := []metricLabel{
+				{"instance", instance},
+				{"interface", intf.Name},
+				{"hostname", host.Hostname},
+			}
+			m.gauge("dns_dynamic_host_status",
+				"Result of the last update of the host.",
+				1, append(labels, metricLabel{"status", host.Status})...)
+			t, err := time.Parse(time.RFC3339, host.LastUpdate)
+			if err != nil {
+				continue
+			}
+			m.gauge("dns_dynamic_host_last_update_timestamp_seconds",
+				"Time of the last update of the host.",
+				float64(t.Unix()), labels...)
+		}
+	}
+}
+
+func collectMetrics(m *metricsWriter, state *StateData) {
+	if dns := state.Service.DNS; dns != nil {
+		collectForwardingMetrics(m, "default", dns.Forwarding)
+		collectDynamicMetrics(m, "default", dns.Dynamic)
+	}
+	if state.Routing == nil {
+		return
+	}
+	ris := append([]RoutingInstanceData(nil), state.Routing.RoutingInstance...)
+	sort.Slice(ris, func(i, j int) bool {
+		return ris[i].Name < ris[j].Name
+	})
+	for _, ri := range ris {
+		collectForwardingMetrics(m, ri.Name, ri.Service.DNS.Forwarding)
+		collectDynamicMetrics(m, ri.Name, ri.Service.DNS.Dynamic)
+	}
+}
+
+func writeMetrics(w io.Writer, state *StateData) error {
+	m := newMetricsWriter()
+	collectMetrics(m, state)
+	return m.write(w)
+}
+
+// metricsServer serves the state as OpenMetrics on /metrics.
+type metricsServer struct {
+	params  MetricsConfigData
+	handler http.Handler
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newMetricsServer(params MetricsConfigData, handler http.Handler) *metricsServer {
+	s := &metricsServer{
+		params:  params,
+		handler: handler,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *metricsServer) listen() (net.Listener, error) {
+	var lc net.ListenConfig
+	if device := s.params.device(); device != "" {
+		lc.Control = func(network, address string, rc syscall.RawConn) error {
+			return dnsclient.BindToDevice(rc, device)
+		}
+	}
+	return lc.Listen(context.Background(), "tcp", s.params.listenAddress())
+}
+
+func (s *metricsServer) run() {
+	defer close(s.done)
+	var ln net.Listener
+	var lastErr string
+	for {
+		var err error
+		ln, err = s.listen()
+		if err == nil {
+			break
+		}
+		// Only log the retries that fail differently.
+		if err.Error() != lastErr {
+			log.Elog.Println("dns-metrics:", err)
+			lastErr = err.Error()
+		} else {
+			log.Dlog.Println("dns-metrics:", err)
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(metricsRetryInterval):
+		}
+	}
+	log.Dlog.Println("dns-metrics: listening on", ln.Addr())
+	srv := &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+		ReadTimeout:       metricsReadTimeout,
+		WriteTimeout:      metricsWriteTimeout,
+	}
+	go func() {
+		<-s.stop
+		srv.Close()
+	}()
+	err := srv.Serve(ln)
+	if err != http.ErrServerClosed {
+		log.Elog.Println("dns-metrics:", err)
+	}
+}
+
+func (s *metricsServer) close() {
+	close(s.stop)
+	<-s.done
+}
+
+// metricsCache serialises scrapes and serves recent metrics again.
+type metricsCache struct {
+	mu       sync.Mutex
+	collect  func() *StateData
+	now      func() time.Time
+	rendered []byte
+	at       time.Time
+}
+
+func (m *metricsCache) get() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if m.rendered != nil && now.Sub(m.at) < metricsCacheTime {
+		return m.rendered, nil
+	}
+	var buf bytes.Buffer
+	err := writeMetrics(&buf, m.collect())
+	if err != nil {
+		return nil, err
+	}
+	m.rendered, m.at = buf.Bytes(), now
+	return m.rendered, nil
+}
+
+func (c *Config) metricsHandler() http.Handler {
+	cache := &metricsCache{
+		collect: func() *StateData { return StateNew(c).Get() },
+		now:     time.Now,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		data, err := cache.get()
+		if err != nil {
+			log.Dlog.Println("dns-metrics:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", metricsContentType)
+		_, err = w.Write(data)
+		if err != nil {
+			log.Dlog.Println("dns-metrics:", err)
+		}
+	})
+	return mux
+}
+
+// syncMetrics starts, restarts or stops the metrics endpoint to match
+// config.
+func (c *Config) syncMetrics(config *ConfigData) {
+	var params *MetricsConfigData
+	if config != nil {
+		params = config.Service.DNS.Metrics
+	}
+	if c.metrics != nil {
+		if params != nil && c.metrics.params == *params {
+			return
+		}
+		c.metrics.close()
+		c.metrics = nil
+	}
+	if params == nil {
+		return
+	}
+	c.metrics = newMetricsServer(*params, c.metricsHandler())
+}
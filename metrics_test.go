@@ -0,0 +1,224 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package dns
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/danos/vyatta-service-dns/internal/dynamic"
+	"github.com/danos/vyatta-service-dns/internal/forwarding"
+)
+
+func metricsTestForwarding(forwarded uint64) *forwarding.StateData {
+	data := &forwarding.StateData{}
+	state := &data.State
+	state.QueriesForwarded = forwarded
+	state.QueriesAnswered = 20
+	state.Cache.Size = 150
+	state.Cache.Entries = 30
+	state.Cache.ReusedEntries = 2
+	state.Nameservers = []forwarding.NameserverState{
+		{IPAddress: "192.0.2.53", Port: 53, QueriesSent: 8,
+			QueriesRetriedOrFailed: 1, InUse: true, Status: "up",
+			RoundTripTime: 25},
+		{IPAddress: "2001:db8::53", Port: 5353, QueriesSent: 2},
+	}
+	return data
+}
+
+func metricsTestState() *StateData {
+	state := &StateData{}
+	fwd := metricsTestForwarding(100)
+	fwd.State.Cache.EntriesRestored = 5
+	fwd.State.DNSSEC = &forwarding.DNSSECState{Validated: 7, Bogus: 1}
+	hits := uint64(3)
+	fwd.State.Blocklists = []forwarding.BlocklistState{
+		{Name: `ads "list" \ 1`, Entries: 1000, Hits: &hits},
+		// Hits that aren't counted have no metric.
+		{Name: "malware", Entries: 10},
+	}
+	dyn := &dynamic.StateData{}
+	dyn.Status.Interfaces = []dynamic.InterfaceStateData{
+		{Name: "dp0s3", Hosts: []dynamic.HostStateData{
+			{Hostname: "host.example.com", Status: "good",
+				LastUpdate: "2026-10-16T10:00:00Z"},
+			// Hosts that were never updated have no last update.
+			{Hostname: "new.example.com", Status: "noconnect"},
+		}},
+	}
+	state.Service.DNS = &DNSStateData{Forwarding: fwd, Dynamic: dyn}
+
+	red := RoutingInstanceData{Name: "red"}
+	red.Service.DNS.Forwarding = metricsTestForwarding(50)
+	blue := RoutingInstanceData{Name: "blue"}
+	blue.Service.DNS.Forwarding = metricsTestForwarding(10)
+	state.Routing = &RoutingStateData{
+		RoutingInstance: []RoutingInstanceData{red, blue},
+	}
+	return state
+}
+
+const expectedMetrics = `# TYPE dns_forwarding_queries_forwarded counter
+# HELP dns_forwarding_queries_forwarded Queries forwarded to a name server.
+dns_forwarding_queries_forwarded_total{instance="default"} 100
+dns_forwarding_queries_forwarded_total{instance="blue"} 10
+dns_forwarding_queries_forwarded_total{instance="red"} 50
+# TYPE dns_forwarding_queries_answered counter
+# HELP dns_forwarding_queries_answered Queries answered from the cache.
+dns_forwarding_queries_answered_total{instance="default"} 20
+dns_forwarding_queries_answered_total{instance="blue"} 20
+dns_forwarding_queries_answered_total{instance="red"} 20
+# TYPE dns_forwarding_cache_size gauge
+# HELP dns_forwarding_cache_size Size of the cache.
+dns_forwarding_cache_size{instance="default"} 150
+dns_forwarding_cache_size{instance="blue"} 150
+dns_forwarding_cache_size{instance="red"} 150
+# TYPE dns_forwarding_cache_insertions counter
+# HELP dns_forwarding_cache_insertions Entries inserted into the cache.
+dns_forwarding_cache_insertions_total{instance="default"} 30
+dns_forwarding_cache_insertions_total{instance="blue"} 30
+dns_forwarding_cache_insertions_total{instance="red"} 30
+# TYPE dns_forwarding_cache_reused_entries counter
+# HELP dns_forwarding_cache_reused_entries Unexpired cache entries reused for new ones.
+dns_forwarding_cache_reused_entries_total{instance="default"} 2
+dns_forwarding_cache_reused_entries_total{instance="blue"} 2
+dns_forwarding_cache_reused_entries_total{instance="red"} 2
+# TYPE dns_forwarding_cache_entries_restored counter
+# HELP dns_forwarding_cache_entries_restored Entries put back into the cache after a restart.
+dns_forwarding_cache_entries_restored_total{instance="default"} 5
+dns_forwarding_cache_entries_restored_total{instance="blue"} 0
+dns_forwarding_cache_entries_restored_total{instance="red"} 0
+# TYPE dns_forwarding_nameserver_queries_sent counter
+# HELP dns_forwarding_nameserver_queries_sent Queries sent to the name server.
+dns_forwarding_nameserver_queries_sent_total{instance="default",address="192.0.2.53",port="53"} 8
+dns_forwarding_nameserver_queries_sent_total{instance="default",address="2001:db8::53",port="5353"} 2
+dns_forwarding_nameserver_queries_sent_total{instance="blue",address="192.0.2.53",port="53"} 8
+dns_forwarding_nameserver_queries_sent_total{instance="blue",address="2001:db8::53",port="5353"} 2
+dns_forwarding_nameserver_queries_sent_total{instance="red",address="192.0.2.53",port="53"} 8
+dns_forwarding_nameserver_queries_sent_total{instance="red",address="2001:db8::53",port="5353"} 2
+# TYPE dns_forwarding_nameserver_queries_failed counter
+# HELP dns_forwarding_nameserver_queries_failed Queries to the name server that were retried or failed.
+dns_forwarding_nameserver_queries_failed_total{instance="default",address="192.0.2.53",port="53"} 1
+dns_forwarding_nameserver_queries_failed_total{instance="default",address="2001:db8::53",port="5353"} 0
+dns_forwarding_nameserver_queries_failed_total{instance="blue",address="192.0.2.53",port="53"} 1
+dns_forwarding_nameserver_queries_failed_total{instance="blue",address="2001:db8::53",port="5353"} 0
+dns_forwarding_nameserver_queries_failed_total{instance="red",address="192.0.2.53",port="53"} 1
+dns_forwarding_nameserver_queries_failed_total{instance="red",address="2001:db8::53",port="5353"} 0
+# TYPE dns_forwarding_nameserver_in_use gauge
+# HELP dns_forwarding_nameserver_in_use Whether the name server is used.
+dns_forwarding_nameserver_in_use{instance="default",address="192.0.2.53",port="53"} 1
+dns_forwarding_nameserver_in_use{instance="default",address="2001:db8::53",port="5353"} 0
+dns_forwarding_nameserver_in_use{instance="blue",address="192.0.2.53",port="53"} 1
+dns_forwarding_nameserver_in_use{instance="blue",address="2001:db8::53",port="5353"} 0
+dns_forwarding_nameserver_in_use{instance="red",address="192.0.2.53",port="53"} 1
+dns_forwarding_nameserver_in_use{instance="red",address="2001:db8::53",port="5353"} 0
+# TYPE dns_forwarding_nameserver_up gauge
+# HELP dns_forwarding_nameserver_up Whether the name server answers health checks.
+dns_forwarding_nameserver_up{instance="default",address="192.0.2.53",port="53"} 1
+dns_forwarding_nameserver_up{instance="blue",address="192.0.2.53",port="53"} 1
+dns_forwarding_nameserver_up{instance="red",address="192.0.2.53",port="53"} 1
+# TYPE dns_forwarding_nameserver_round_trip_time_seconds gauge
+# HELP dns_forwarding_nameserver_round_trip_time_seconds Time the last successful health check took.
+dns_forwarding_nameserver_round_trip_time_seconds{instance="default",address="192.0.2.53",port="53"} 0.025
+dns_forwarding_nameserver_round_trip_time_seconds{instance="blue",address="192.0.2.53",port="53"} 0.025
+dns_forwarding_nameserver_round_trip_time_seconds{instance="red",address="192.0.2.53",port="53"} 0.025
+# TYPE dns_forwarding_dnssec_validated_answers counter
+# HELP dns_forwarding_dnssec_validated_answers Answers validated as secure.
+dns_forwarding_dnssec_validated_answers_total{instance="default"} 7
+# TYPE dns_forwarding_dnssec_bogus_answers counter
+# HELP dns_forwarding_dnssec_bogus_answers Answers that failed validation.
+dns_forwarding_dnssec_bogus_answers_total{instance="default"} 1
+# TYPE dns_forwarding_blocklist_entries gauge
+# HELP dns_forwarding_blocklist_entries Domains blocked by the blocklist.
+dns_forwarding_blocklist_entries{instance="default",blocklist="ads \"list\" \\ 1"} 1000
+dns_forwarding_blocklist_entries{instance="default",blocklist="malware"} 10
+# TYPE dns_forwarding_blocklist_hits counter
+# HELP dns_forwarding_blocklist_hits Queries answered by the blocklist.
+dns_forwarding_blocklist_hits_total{instance="default",blocklist="ads \"list\" \\ 1"} 3
+# TYPE dns_dynamic_host_status gauge
+# HELP dns_dynamic_host_status Result of the last update of the host.
+dns_dynamic_host_status{instance="default",interface="dp0s3",hostname="host.example.com",status="good"} 1
+dns_dynamic_host_status{instance="default",interface="dp0s3",hostname="new.example.com",status="noconnect"} 1
+# TYPE dns_dynamic_host_last_update_timestamp_seconds gauge
+# HELP dns_dynamic_host_last_update_timestamp_seconds Time of the last update of the host.
+dns_dynamic_host_last_update_timestamp_seconds{instance="default",interface="dp0s3",hostname="host.example.com"} 1.7921448e+09
+# EOF
+`
+
+func TestWriteMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeMetrics(&buf, metricsTestState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expectedMetrics {
+		t.Log("got", buf.String())
+		t.Log("expected", expectedMetrics)
+		t.Fatal("didn't get expected metrics")
+	}
+}
+
+func TestWriteMetricsEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeMetrics(&buf, &StateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "# EOF\n" {
+		t.Fatal("unexpected metrics", buf.String())
+	}
+}
+
+func TestLabelEscaper(t *testing.T) {
+	got := labelEscaper.Replace("a\\b\"c\nd")
+	const expected = `a\\b\"c\nd`
+	if got != expected {
+		t.Fatalf("got %s, expected %s", got, expected)
+	}
+}
+
+func TestMetricsCache(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	collected := 0
+	cache := &metricsCache{
+		collect: func() *StateData {
+			collected++
+			return &StateData{}
+		},
+		now: func() time.Time { return now },
+	}
+	for i := 0; i < 2; i++ {
+		_, err := cache.get()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if collected != 1 {
+		t.Fatal("state collected for every scrape", collected)
+	}
+	now = now.Add(metricsCacheTime)
+	_, err := cache.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collected != 2 {
+		t.Fatal("stale metrics served", collected)
+	}
+}
+
+func TestMetricsListenAddress(t *testing.T) {
+	for _, test := range []struct {
+		params   MetricsConfigData
+		expected string
+	}{
+		{MetricsConfigData{}, "127.0.0.1:9153"},
+		{MetricsConfigData{Address: "2001:db8::1", Port: 9100},
+			"[2001:db8::1]:9100"},
+	} {
+		if got := test.params.listenAddress(); got != test.expected {
+			t.Fatalf("got %s, expected %s", got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2026, AT&T Intellectual Property. All rights reserved.
+// SPDX-License-Identifier: GPL-2.0-only
+package dns
+
+import (
+	"github.com/danos/vyatta-service-dns/internal/forwarding"
+	"github.com/danos/vyatta-service-dns/internal/log"
+)
+
+// Emitter sends YANG notifications, it is satisfied by a VCI client.
+type Emitter interface {
+	Emit(moduleName, notificationName string, object interface{}) error
+}
+
+type nameserversUpdated struct {
+	ActiveNameservers []forwarding.ActiveNameserver `rfc7951:"vyatta-service-dns-v1:active-nameservers,omitempty"`
+	RoutingInstance   string                        `rfc7951:"vyatta-service-dns-routing-instance-v1:routing-instance,omitempty"`
+}
+
+type forwardingNotifier struct {
+	emitter Emitter
+}
+
+func (n *forwardingNotifier) NameserversUpdated(
+	instance string,
+	nameservers []forwarding.ActiveNameserver,
+) {
+	data := nameserversUpdated{
+		ActiveNameservers: nameservers,
+	}
+	if instance != "default" {
+		data.RoutingInstance = instance
+	}
+	err := n.emitter.Emit("vyatta-service-dns-v1",
+		"dns-forwarding-nameservers-updated", &data)
+	if err != nil {
+		log.Elog.Println("nameservers-updated:", err)
+	}
+}
+
+type nameserverStatusChanged struct {
+	Address         string `rfc7951:"vyatta-service-dns-v1:address"`
+	Port            uint16 `rfc7951:"vyatta-service-dns-v1:port"`
+	Status          string `rfc7951:"vyatta-service-dns-v1:status"`
+	RoutingInstance string `rfc7951:"vyatta-service-dns-routing-instance-v1:routing-instance,omitempty"`
+}
+
+func (n *forwardingNotifier) NameserverStatusChanged(
+	instance string,
+	status forwarding.NameserverHealth,
+) {
+	data := nameserverStatusChanged{
+		Address: status.Address,
+		Port:    status.Port,
+		Status:  status.Status,
+	}
+	if instance != "default" {
+		data.RoutingInstance = instance
+	}
+	err := n.emitter.Emit("vyatta-service-dns-v1",
+		"dns-forwarding-nameserver-status-changed", &data)
+	if err != nil {
+		log.Elog.Println("nameserver-status-changed:", err)
+	}
+}
+
+func (c *Config) forwardingNotifications() forwarding.ConfigOption {
+	if c.emitter == nil {
+		return func(*forwarding.Config) {}
+	}
+	return forwarding.Notifications(&forwardingNotifier{emitter: c.emitter})
+}
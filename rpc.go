@@ -54,6 +54,100 @@ func (r *RPC) ResetDnsForwardingCache(in struct {
 	return forwarding.RPCNew(c).ResetDnsForwardingCache()
 }
 
+func (r *RPC) forwardingInstance(instance string) (*forwarding.Config, error) {
+	if instance == "" {
+		instance = "default"
+	}
+	c, ok := r.conf.getForwardingInstances()[instance]
+	if !ok {
+		err := mgmterror.NewMustViolationError()
+		err.Path = "/routing-instance/" + instance
+		err.Message = "DNS forwarding is not configured on requested instance"
+		return nil, err
+	}
+	return c, nil
+}
+
+func cacheRPCError(err error) error {
+	merr := mgmterror.NewOperationFailedApplicationError()
+	merr.Message = err.Error()
+	return merr
+}
+
+type lookupCacheOutput struct {
+	Entries []forwarding.CacheEntry `rfc7951:"vyatta-service-dns-v1:entries,omitempty"`
+}
+
+func (r *RPC) LookupDnsForwardingCache(in struct {
+	Name            string `rfc7951:"vyatta-service-dns-v1:name"`
+	RoutingInstance string `rfc7951:"vyatta-service-dns-routing-instance-v1:routing-instance"`
+}) (lookupCacheOutput, error) {
+	var out lookupCacheOutput
+	c, err := r.forwardingInstance(in.RoutingInstance)
+	if err != nil {
+		return out, err
+	}
+	out.Entries, err = forwarding.RPCNew(c).LookupDnsForwardingCache(in.Name)
+	if err != nil {
+		return out, cacheRPCError(err)
+	}
+	return out, nil
+}
+
+type flushCacheOutput struct {
+	Flushed uint32 `rfc7951:"vyatta-service-dns-v1:flushed-entries"`
+}
+
+func (r *RPC) FlushDnsForwardingCache(in struct {
+	Name              string `rfc7951:"vyatta-service-dns-v1:name"`
+	IncludeSubdomains bool   `rfc7951:"vyatta-service-dns-v1:include-subdomains,emptyleaf"`
+	RoutingInstance   string `rfc7951:"vyatta-service-dns-routing-instance-v1:routing-instance"`
+}) (flushCacheOutput, error) {
+	var out flushCacheOutput
+	c, err := r.forwardingInstance(in.RoutingInstance)
+	if err != nil {
+		return out, err
+	}
+	out.Flushed, err = forwarding.RPCNew(c).FlushDnsForwardingCache(
+		in.Name, in.IncludeSubdomains)
+	if err != nil {
+		return out, cacheRPCError(err)
+	}
+	return out, nil
+}
+
+type resolveOutput struct {
+	Rcode   string                     `rfc7951:"vyatta-service-dns-v1:rcode"`
+	Answers []forwarding.ResolveAnswer `rfc7951:"vyatta-service-dns-v1:answers,omitempty"`
+	Server  string                     `rfc7951:"vyatta-service-dns-v1:server"`
+	Latency uint32                     `rfc7951:"vyatta-service-dns-v1:latency"`
+}
+
+func (r *RPC) ResolveDnsName(in struct {
+	Name            string `rfc7951:"vyatta-service-dns-v1:name"`
+	Type            string `rfc7951:"vyatta-service-dns-v1:type"`
+	Upstream        string `rfc7951:"vyatta-service-dns-v1:upstream"`
+	RoutingInstance string `rfc7951:"vyatta-service-dns-routing-instance-v1:routing-instance"`
+}) (resolveOutput, error) {
+	var out resolveOutput
+	c, err := r.forwardingInstance(in.RoutingInstance)
+	if err != nil {
+		return out, err
+	}
+	res, err := forwarding.RPCNew(c).ResolveDnsName(in.Name, in.Type,
+		in.Upstream)
+	if err != nil {
+		merr := mgmterror.NewOperationFailedApplicationError()
+		merr.Message = "Failed to resolve " + in.Name + ": " + err.Error()
+		return out, merr
+	}
+	out.Rcode = res.Rcode
+	out.Answers = res.Answers
+	out.Server = res.Server
+	out.Latency = res.Latency
+	return out, nil
+}
+
 func (r *RPC) UpdateDynamicDnsInterface(
 	in struct {
 		Interface string `rfc7951:"vyatta-service-dns-v1:interface"`